@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+const (
+	apiTasksPath = `/api/v1/tasks`
+	apiSyncPath  = `/api/v1/sync`
+)
+
+// syncResultView is the json representation of a manual sync result.
+type syncResultView struct {
+	Name    string `json:"name"`
+	HeadSha string `json:"headSha,omitempty"`
+	HeadRef string `json:"headRef,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func registerApi(mux *http.ServeMux) {
+	mux.HandleFunc(apiTasksPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJsonError(w, http.StatusMethodNotAllowed, `method is not allowed`)
+			return
+		}
+		runners := appTasks.list()
+		views := make([]*taskStatusView, 0, len(runners))
+		for _, runner := range runners {
+			views = append(views, runner.status.view(runner.config))
+		}
+		writeJson(w, http.StatusOK, views)
+	})
+
+	mux.HandleFunc(apiTasksPath+`/`, func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, apiTasksPath+`/`), `/`)
+		if len(parts[0]) == 0 || len(parts) > 2 || (len(parts) == 2 && parts[1] != `sync`) {
+			writeJsonError(w, http.StatusNotFound, `not found`)
+			return
+		}
+
+		runner, found := appTasks.get(parts[0])
+		if !found {
+			writeJsonError(w, http.StatusNotFound, `task is not found`)
+			return
+		}
+
+		if len(parts) == 2 {
+			if r.Method != http.MethodPost {
+				writeJsonError(w, http.StatusMethodNotAllowed, `method is not allowed`)
+				return
+			}
+			if runner.config.RunOnce {
+				writeJsonError(w, http.StatusConflict, `run-once task cannot be triggered`)
+				return
+			}
+			result := triggerSync(r.Context(), runner)
+			status := http.StatusOK
+			if len(result.Error) > 0 {
+				status = http.StatusInternalServerError
+			}
+			writeJson(w, status, result)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			writeJsonError(w, http.StatusMethodNotAllowed, `method is not allowed`)
+			return
+		}
+		writeJson(w, http.StatusOK, runner.status.view(runner.config))
+	})
+
+	mux.HandleFunc(apiSyncPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJsonError(w, http.StatusMethodNotAllowed, `method is not allowed`)
+			return
+		}
+		results := triggerSyncAll(r.Context(), appTasks.list())
+		status := http.StatusOK
+		for _, result := range results {
+			if len(result.Error) > 0 {
+				status = http.StatusInternalServerError
+			}
+		}
+		writeJson(w, status, results)
+	})
+}
+
+// triggerSync runs the sync of the task and waits for the result.
+func triggerSync(ctx context.Context, runner *taskRunner) *syncResultView {
+	call := runner.Trigger()
+	result := &syncResultView{
+		Name: runner.config.Name,
+	}
+	select {
+	case <-call.Done():
+		if err := call.Err(); err != nil {
+			result.Error = err.Error()
+		}
+	case <-ctx.Done():
+		result.Error = ctx.Err().Error()
+	}
+	view := runner.status.view(runner.config)
+	result.HeadSha = view.HeadSha
+	result.HeadRef = view.HeadRef
+	return result
+}
+
+// triggerSyncAll triggers all periodic tasks at once and waits for all results.
+func triggerSyncAll(ctx context.Context, runners []*taskRunner) []*syncResultView {
+	periodic := make([]*taskRunner, 0, len(runners))
+	for _, runner := range runners {
+		if !runner.config.RunOnce {
+			periodic = append(periodic, runner)
+		}
+	}
+
+	results := make([]*syncResultView, len(periodic))
+	done := make(chan struct{})
+	for i, runner := range periodic {
+		go func(i int, runner *taskRunner) {
+			results[i] = triggerSync(ctx, runner)
+			done <- struct{}{}
+		}(i, runner)
+	}
+	for range periodic {
+		<-done
+	}
+	return results
+}
+
+func writeJsonError(w http.ResponseWriter, status int, message string) {
+	writeJson(w, status, map[string]string{
+		`error`: message,
+	})
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/urfave/cli/v2"
+	"time"
 )
 
 var (
@@ -63,7 +64,7 @@ var (
 
 	configFileFlag = cli.StringFlag{
 		Name:       `config`,
-		Required:   true,
+		Required:   false,
 		Usage:      `path to the yaml config file`,
 		Category:   `config`,
 		Value:      ``,
@@ -99,4 +100,66 @@ var (
 			`GIT_SYNC_PORT`,
 		},
 	}
+
+	shutdownTimeoutFlag = cli.DurationFlag{
+		Name:        `shutdown-timeout`,
+		Required:    false,
+		Usage:       `Grace period for in-flight clone/pull operations on SIGTERM/SIGINT`,
+		Value:       30 * time.Second,
+		DefaultText: `30s`,
+		HasBeenSet:  true,
+		Category:    `config`,
+		EnvVars: []string{
+			`GIT_SYNC_SHUTDOWN_TIMEOUT`,
+		},
+	}
+
+	stallTimeoutFlag = cli.DurationFlag{
+		Name:        `stall-timeout`,
+		Required:    false,
+		Usage:       `Liveness fails if a task run is overdue by more than this timeout`,
+		Value:       10 * time.Minute,
+		DefaultText: `10m`,
+		HasBeenSet:  true,
+		Category:    `metrics`,
+		EnvVars: []string{
+			`GIT_SYNC_STALL_TIMEOUT`,
+		},
+	}
+
+	configReloadIntervalFlag = cli.DurationFlag{
+		Name:        `config-reload-interval`,
+		Required:    false,
+		Usage:       `How often the config file is checked for changes, 0 disables it (SIGHUP always reloads the config)`,
+		Value:       10 * time.Second,
+		DefaultText: `10s`,
+		HasBeenSet:  true,
+		Category:    `config`,
+		EnvVars: []string{
+			`GIT_SYNC_CONFIG_RELOAD_INTERVAL`,
+		},
+	}
+
+	cleanupRemovedFlag = cli.BoolFlag{
+		Name:        `cleanup-removed`,
+		Required:    false,
+		Usage:       `Delete directories of tasks that are removed from the config on reload`,
+		Value:       false,
+		DefaultText: `false`,
+		HasBeenSet:  false,
+		Category:    `config`,
+		EnvVars: []string{
+			`GIT_SYNC_CLEANUP_REMOVED`,
+		},
+	}
+
+	validateConfigFileFlag = cli.StringFlag{
+		Name:     `config`,
+		Required: false,
+		Usage:    `path to the yaml config file`,
+		EnvVars: []string{
+			`CONFIG`,
+			`GIT_SYNC_CONFIG`,
+		},
+	}
 )
@@ -2,33 +2,72 @@ package main
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/go-git/go-git/v5"
+	gitConfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	gitTransport "github.com/go-git/go-git/v5/plumbing/transport"
 	gitHttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitSsh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	log "github.com/sirupsen/logrus"
 	"net/url"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
 	. "registry.fozzy.lan/palefat/git-sync-go/git"
+	. "registry.fozzy.lan/palefat/git-sync-go/scheduler"
+	"sort"
 	"strings"
 	"time"
 )
 
 const (
-	defaultIntervalSeconds = 60
+	defaultIntervalSeconds      = 60
+	defaultSshUser              = `git`
+	defaultRetryMultiplier      = 2
+	defaultRetryMaxDelaySeconds = 3600
+	defaultKeepRevisions        = 1
+	defaultHookTimeoutSeconds   = 60
+	defaultNotifyTimeoutSeconds = 10
+	defaultNotifyRetries        = 3
+
+	maskedValue = `*******`
+
+	OnErrorContinue = `continue`
+	OnErrorExit     = `exit`
+
+	LocalChangesDiscard  = `discard`
+	LocalChangesPreserve = `preserve`
+	LocalChangesFail     = `fail`
+	LocalChangesStash    = `stash`
+
+	OnForcePushReset = `reset`
+	OnForcePushFail  = `fail`
+
+	CleanNone             = `none`
+	CleanUntracked        = `untracked`
+	CleanUntrackedIgnored = `untracked+ignored`
+
+	NotifyEventSynced    = `synced`
+	NotifyEventFailed    = `failed`
+	NotifyEventRecovered = `recovered`
 )
 
 var (
 	ErrBasicAuthUserIsMissing     = errors.New(`user is not configured for basic config`)
 	ErrBasicAuthPasswordIsMissing = errors.New(`password is not configured for basic config`)
+	ErrSshPrivateKeyIsMissing     = errors.New(`private key is not configured for ssh config`)
 
 	ErrNameIsMissing   = errors.New(`task name is missing`)
 	ErrNameIsNotUnique = errors.New(`task name is not unique`)
 	ErrPathIsMissing   = errors.New(`task path is missing`)
 	ErrPathIsNotUnique = errors.New(`task path is not unique`)
+	ErrPathIsNested    = errors.New(`task path overlaps with another task`)
+
+	ErrPublishIsNotUnique = errors.New(`publish link or worktrees dir is not unique`)
 
 	ErrGitRepoUrlIsNotValid           = errors.New(`git repo url is not valid`)
 	ErrGitRepoUrlSchemaIsNotSupported = errors.New(`git repo url schema is not supported`)
@@ -39,88 +78,858 @@ type Validatable interface {
 }
 
 type Config struct {
-	Validatable
-	Tasks []*TaskConfig `yaml:"tasks" json:"tasks"`
+	Validatable `yaml:"-" json:"-"`
+	KnownHosts  *Secret   `yaml:"knownHosts,omitempty" json:"knownHosts,omitempty"`
+	Webhooks    *Webhooks `yaml:"webhooks,omitempty" json:"webhooks,omitempty"`
+	// Notify is used by all tasks in addition to their own notify configs
+	Notify []*Notify     `yaml:"notify,omitempty" json:"notify,omitempty"`
+	Tasks  []*TaskConfig `yaml:"tasks" json:"tasks"`
 }
 
+// Validate returns the first problem of the config, the environment is checked only if the config itself is valid.
 func (c *Config) Validate() error {
+	if errs := c.ValidateAll(); len(errs) > 0 {
+		return errs[0]
+	}
+	if errs := c.CheckAll(); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// ValidateAll returns all problems of the config itself instead of the first one, the environment of the app
+// (secrets, keys and the git cli) is not checked, see CheckAll.
+// Problems of global fields are returned as *ConfigFieldError.
+// Problems of tasks are returned as *TaskConfigError, they wrap *TaskFieldError.
+func (c *Config) ValidateAll() []error {
+
+	var errs []error
+
+	if c.Webhooks != nil {
+		for _, secret := range c.Webhooks.secrets() {
+			if err := secret.validate(); err != nil {
+				errs = append(errs, &ConfigFieldError{Field: secret.field, Err: err})
+			}
+		}
+	}
+
+	for i, notify := range c.Notify {
+		if err := notify.Validate(); err != nil {
+			field := fmt.Sprintf(`notify[%d]`, i)
+			errs = append(errs, &ConfigFieldError{Field: field, Err: fmt.Errorf(`%s -> %s`, field, err.Error())})
+		}
+	}
+
+	for i, taskConfig := range c.Tasks {
+		if c.KnownHosts != nil && taskConfig.isSshUrl() {
+			taskConfig.inheritKnownHosts(c.KnownHosts)
+		}
+		for _, err := range taskConfig.ValidateAll() {
+			errs = append(errs, &TaskConfigError{
+				Index: i,
+				Name:  taskConfig.Name,
+				Err:   err,
+			})
+		}
+	}
+
+	return append(errs, c.conflicts()...)
+}
+
+// CheckAll returns all problems of the environment the config is used in: secrets that cannot be read,
+// keys that cannot be parsed and the git cli of sparse tasks. The config has to be validated first.
+func (c *Config) CheckAll() []error {
+
+	var errs []error
+
+	var secrets []configSecret
+	if c.Webhooks != nil {
+		secrets = append(secrets, c.Webhooks.secrets()...)
+	}
+	for i, notify := range c.Notify {
+		secrets = append(secrets, notify.secrets(fmt.Sprintf(`notify[%d]`, i))...)
+	}
+	for _, secret := range secrets {
+		if err := secret.check(); err != nil {
+			errs = append(errs, &ConfigFieldError{Field: secret.field, Err: err})
+		}
+	}
+
+	for i, taskConfig := range c.Tasks {
+		for _, err := range taskConfig.CheckAll() {
+			errs = append(errs, &TaskConfigError{
+				Index: i,
+				Name:  taskConfig.Name,
+				Err:   err,
+			})
+		}
+	}
+
+	return errs
+}
+
+// conflicts returns all pairs of tasks with the same name and all pairs of tasks whose paths, publish links
+// or worktrees dirs point to the same location (through symlinks or `..`) or are nested in each other.
+// The error is reported for the later task of the pair.
+func (c *Config) conflicts() []error {
+	var errs []error
 
 	names := make(map[string]bool, len(c.Tasks))
-	paths := make(map[string]bool, len(c.Tasks))
+	owned := make([][]ownedPath, len(c.Tasks))
+	for i, taskConfig := range c.Tasks {
+		owned[i] = taskConfig.ownedFields()
+	}
 
-	for _, taskConfig := range c.Tasks {
-		err := taskConfig.Validate()
-		if err != nil {
-			return err
+	for i, taskConfig := range c.Tasks {
+		conflict := func(field string, err error) {
+			errs = append(errs, &TaskConfigError{
+				Index: i,
+				Name:  taskConfig.Name,
+				Err:   &TaskFieldError{Field: field, Err: err},
+			})
 		}
-		if names[taskConfig.Name] {
-			return ErrNameIsNotUnique
+
+		if len(taskConfig.Name) > 0 {
+			if names[taskConfig.Name] {
+				conflict(`name`, ErrNameIsNotUnique)
+			}
+			names[taskConfig.Name] = true
 		}
-		if paths[taskConfig.Path] {
-			return ErrPathIsNotUnique
+
+		for j := 0; j < i; j++ {
+			other := c.Tasks[j]
+			for _, path := range owned[i] {
+				for _, otherPath := range owned[j] {
+					if err := path.overlap(otherPath, other.Name); err != nil {
+						conflict(path.field, err)
+					}
+				}
+			}
 		}
 	}
+	return errs
+}
+
+// ownedPath is a path written by the task, field is the config field of the path.
+type ownedPath struct {
+	field    string
+	path     string
+	resolved string
+}
+
+// overlap returns the error if the path is the same location as the path of the other task or they are nested.
+func (p ownedPath) overlap(other ownedPath, otherName string) error {
+	otherPath := other.path
+	if other.field != `path` {
+		otherPath = other.field + ` ` + other.path
+	}
+	switch {
+	case p.resolved == other.resolved && p.field != `path` && other.field != `path`:
+		return fmt.Errorf(`%w: %s is used by task %s`, ErrPublishIsNotUnique, p.path, otherName)
+	case p.resolved == other.resolved:
+		return fmt.Errorf(`%w: %s is the same location as %s of task %s`, ErrPathIsNotUnique, p.path, otherPath, otherName)
+	case isSubPath(other.resolved, p.resolved):
+		return fmt.Errorf(`%w: %s is inside %s of task %s`, ErrPathIsNested, p.path, otherPath, otherName)
+	case isSubPath(p.resolved, other.resolved):
+		return fmt.Errorf(`%w: %s contains %s of task %s`, ErrPathIsNested, p.path, otherPath, otherName)
+	}
 	return nil
 }
 
+// resolvePath returns the absolute path with symlinks of its existing part resolved,
+// so different spellings of the same location are equal.
+func resolvePath(path string) string {
+	resolved, err := filepath.Abs(path)
+	if err != nil {
+		resolved = filepath.Clean(path)
+	}
+	var missing []string
+	for {
+		if target, err := filepath.EvalSymlinks(resolved); err == nil {
+			return filepath.Join(append([]string{target}, missing...)...)
+		}
+		parent := filepath.Dir(resolved)
+		if parent == resolved {
+			return filepath.Join(append([]string{resolved}, missing...)...)
+		}
+		missing = append([]string{filepath.Base(resolved)}, missing...)
+		resolved = parent
+	}
+}
+
+// isSubPath checks if the path is inside the parent dir, both paths have to be resolved.
+func isSubPath(parent string, path string) bool {
+	rel, err := filepath.Rel(parent, path)
+	return err == nil && rel != `.` && rel != `..` && !strings.HasPrefix(rel, `..`+string(filepath.Separator))
+}
+
+// ConfigFieldError is a problem of the global config field, Field is a path like `webhooks` or `notify[1].secret`.
+type ConfigFieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *ConfigFieldError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigFieldError) Unwrap() error {
+	return e.Err
+}
+
+// TaskConfigError is a problem of the task at the Index of the tasks list.
+type TaskConfigError struct {
+	Index int
+	Name  string
+	Err   error
+}
+
+func (e *TaskConfigError) Error() string {
+	if len(e.Name) == 0 {
+		return fmt.Sprintf(`tasks[%d] -> %v`, e.Index, e.Err)
+	}
+	return fmt.Sprintf(`task %s -> %v`, e.Name, e.Err)
+}
+
+func (e *TaskConfigError) Unwrap() error {
+	return e.Err
+}
+
+// Webhooks contains secrets of push webhooks per provider, a provider is disabled if its secret is not set.
+type Webhooks struct {
+	// Github is the secret of the HMAC signature (X-Hub-Signature-256)
+	Github *Secret `yaml:"github,omitempty" json:"github,omitempty"`
+	// Gitlab is the secret token (X-Gitlab-Token)
+	Gitlab *Secret `yaml:"gitlab,omitempty" json:"gitlab,omitempty"`
+	// Gitea is the secret of the HMAC signature (X-Gitea-Signature)
+	Gitea *Secret `yaml:"gitea,omitempty" json:"gitea,omitempty"`
+}
+
+func (w *Webhooks) secrets() []configSecret {
+	var secrets []configSecret
+	for _, secret := range []configSecret{
+		{field: `webhooks.github`, name: `webhooks -> github`, secret: w.Github},
+		{field: `webhooks.gitlab`, name: `webhooks -> gitlab`, secret: w.Gitlab},
+		{field: `webhooks.gitea`, name: `webhooks -> gitea`, secret: w.Gitea},
+	} {
+		if secret.secret != nil {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
 type TaskConfig struct {
-	Validatable
-	Name       string `yaml:"name" json:"name"`
-	Url        string `yaml:"url" json:"url"`
-	Path       string `yaml:"path" json:"path"`
-	Insecure   bool   `yaml:"insecure,omitempty" json:"insecure,omitempty"`
-	Depth      int    `yaml:"depth,omitempty" json:"depth,omitempty"`
-	Submodules bool   `yaml:"submodules,omitempty" json:"submodules,omitempty"`
-	Auth       *Auth  `yaml:"auth,omitempty" json:"auth,omitempty"`
-	RemoteName string `yaml:"remoteName,omitempty" json:"remoteName,omitempty"`
-	Reference  struct {
-		Tag    string `yaml:"tag,omitempty" json:"tag,omitempty"`
-		Branch string `yaml:"branch,omitempty" json:"branch,omitempty"`
+	Validatable `yaml:"-" json:"-"`
+	Name        string `yaml:"name" json:"name"`
+	Url         string `yaml:"url" json:"url"`
+	Path        string `yaml:"path" json:"path"`
+	Insecure    bool   `yaml:"insecure,omitempty" json:"insecure,omitempty"`
+	Depth       int    `yaml:"depth,omitempty" json:"depth,omitempty"`
+	Submodules  bool   `yaml:"submodules,omitempty" json:"submodules,omitempty"`
+	Auth        *Auth  `yaml:"auth,omitempty" json:"auth,omitempty"`
+	RemoteName  string `yaml:"remoteName,omitempty" json:"remoteName,omitempty"`
+	Reference   struct {
+		Tag        string `yaml:"tag,omitempty" json:"tag,omitempty"`
+		Branch     string `yaml:"branch,omitempty" json:"branch,omitempty"`
+		Commit     string `yaml:"commit,omitempty" json:"commit,omitempty"`
+		Semver     string `yaml:"semver,omitempty" json:"semver,omitempty"`
+		TagPattern string `yaml:"tagPattern,omitempty" json:"tagPattern,omitempty"`
 	} `yaml:"reference,omitempty" json:"reference,omitempty"`
-	RunOnce         bool  `yaml:"runOnce,omitempty" json:"runOnce,omitempty"`
-	IntervalSeconds int   `yaml:"intervalSeconds,omitempty" json:"intervalSeconds,omitempty"`
-	Force           bool  `yaml:"force,omitempty" json:"force,omitempty"`
-	SingleBranch    *bool `yaml:"singleBranch,omitempty" json:"singleBranch,omitempty"`
-	Progress        bool  `yaml:"progress,omitempty" json:"progress,omitempty"`
+	RunOnce         bool `yaml:"runOnce,omitempty" json:"runOnce,omitempty"`
+	IntervalSeconds int  `yaml:"intervalSeconds,omitempty" json:"intervalSeconds,omitempty"`
+	// Schedule is a cron expression, it is used instead of intervalSeconds
+	Schedule     string `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+	Force        bool   `yaml:"force,omitempty" json:"force,omitempty"`
+	SingleBranch *bool  `yaml:"singleBranch,omitempty" json:"singleBranch,omitempty"`
+	Progress     bool   `yaml:"progress,omitempty" json:"progress,omitempty"`
+	// OnError defines what to do when the task fails: continue (default) or exit the app
+	OnError string `yaml:"onError,omitempty" json:"onError,omitempty"`
+	// LocalChanges defines what to do with local changes of tracked files before the pull:
+	// discard (default), preserve, fail or stash
+	LocalChanges string `yaml:"localChanges,omitempty" json:"localChanges,omitempty"`
+	// OnForcePush defines what to do when the remote ref cannot be fast-forwarded because its history
+	// has been rewritten: reset (default) the worktree to the remote or fail
+	OnForcePush string `yaml:"onForcePush,omitempty" json:"onForcePush,omitempty"`
+	// Clean deletes untracked files after each successful pull
+	Clean *Clean `yaml:"clean,omitempty" json:"clean,omitempty"`
+	// MaxFailures is a number of consecutive failures after which the task is stopped (continue)
+	// or the app exits (exit). 0 means unlimited for continue and 1 for exit.
+	MaxFailures int `yaml:"maxFailures,omitempty" json:"maxFailures,omitempty"`
+	// Retry defines delays between runs after failures, the interval is used if it is not set
+	Retry *Retry `yaml:"retry,omitempty" json:"retry,omitempty"`
+	// ReadinessGate defines if the app is not ready until the task is cloned, true by default
+	ReadinessGate *bool `yaml:"readinessGate,omitempty" json:"readinessGate,omitempty"`
+	// Publish checks out each revision into its own dir and switches the link to it after the sync
+	Publish *Publish  `yaml:"publish,omitempty" json:"publish,omitempty"`
+	Hooks   *Hooks    `yaml:"hooks,omitempty" json:"hooks,omitempty"`
+	Notify  []*Notify `yaml:"notify,omitempty" json:"notify,omitempty"`
+	// Sparse is a list of dirs that are checked out (cone mode), the whole tree is checked out if it is empty
+	Sparse []string `yaml:"sparse,omitempty" json:"sparse,omitempty"`
+	// Verify requires the synced commit (or the tag for tag references) to be signed by an allowed key
+	Verify *Verify `yaml:"verify,omitempty" json:"verify,omitempty"`
+}
+
+// TaskFieldError is a problem of the task field, Field is a path like `auth.ssh` or `sparse[1]`.
+type TaskFieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *TaskFieldError) Error() string {
+	return e.Err.Error()
 }
 
+func (e *TaskFieldError) Unwrap() error {
+	return e.Err
+}
+
+// Validate returns the first problem of the task, the environment is checked only if the task itself is valid.
 func (c *TaskConfig) Validate() error {
+	if errs := c.ValidateAll(); len(errs) > 0 {
+		return errs[0]
+	}
+	if errs := c.CheckAll(); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// ValidateAll returns all problems of the task as *TaskFieldError, defaults are set for fields that are not set.
+func (c *TaskConfig) ValidateAll() []error {
+	var errs []error
+	fail := func(field string, err error) {
+		errs = append(errs, &TaskFieldError{Field: field, Err: err})
+	}
+
 	if len(c.Name) == 0 {
-		return ErrNameIsMissing
+		fail(`name`, ErrNameIsMissing)
 	}
 	if len(c.Path) == 0 {
-		return ErrPathIsMissing
+		fail(`path`, ErrPathIsMissing)
 	}
-	parsedUrl, err := url.Parse(c.Url)
+	protocol := ``
+	endpoint, err := gitTransport.NewEndpoint(c.Url)
 	if err != nil {
-		return ErrGitRepoUrlIsNotValid
-	}
-	urlScheme := parsedUrl.Scheme
-	if urlScheme != `http` && urlScheme != `https` {
-		return ErrGitRepoUrlSchemaIsNotSupported
+		fail(`url`, ErrGitRepoUrlIsNotValid)
+	} else if protocol = endpoint.Protocol; protocol != `http` && protocol != `https` && protocol != `ssh` {
+		fail(`url`, ErrGitRepoUrlSchemaIsNotSupported)
 	}
-	if len(c.Path) == 0 {
-		return fmt.Errorf(`target directory (path) is not set`)
+	if len(c.Schedule) > 0 {
+		if c.IntervalSeconds > 0 {
+			fail(`schedule`, fmt.Errorf(`you cannot configure schedule and intervalSeconds simultaneously`))
+		}
+		if c.Retry != nil {
+			fail(`retry`, fmt.Errorf(`retry cannot be used with schedule, failed runs are retried on the next cron tick`))
+		}
+		if _, err = NormalizeCron(c.Schedule); err != nil {
+			fail(`schedule`, fmt.Errorf(`schedule -> %s`, err.Error()))
+		}
 	}
-	if c.IntervalSeconds < 20 {
+	// cron tasks have no interval, so it stays unset
+	if len(c.Schedule) == 0 && c.IntervalSeconds < 20 {
 		c.IntervalSeconds = 20
 	}
-	if (len(c.Reference.Branch) > 0) && (len(c.Reference.Tag) > 0) {
-		return fmt.Errorf(`you cannot configure branch and tag simultaneously`)
+	refCount := 0
+	for _, ref := range []string{c.Reference.Branch, c.Reference.Tag, c.Reference.Commit} {
+		if len(ref) > 0 {
+			refCount++
+		}
+	}
+	if c.TracksTags() {
+		refCount++
+	}
+	if refCount > 1 {
+		fail(`reference`, fmt.Errorf(`you cannot configure branch, tag, commit and semver/tagPattern simultaneously`))
+	}
+	if c.TracksTags() {
+		if _, err = c.TagSelector(); err != nil {
+			fail(`reference`, fmt.Errorf(`reference -> %s`, err.Error()))
+		}
+	}
+	if len(c.Reference.Commit) > 0 {
+		c.Reference.Commit = strings.ToLower(c.Reference.Commit)
+		if !plumbing.IsHash(c.Reference.Commit) {
+			fail(`reference.commit`, fmt.Errorf(`reference -> commit -> %s is not a full commit sha`, c.Reference.Commit))
+		}
+	}
+	switch c.OnError {
+	case ``:
+		c.OnError = OnErrorContinue
+	case OnErrorContinue, OnErrorExit:
+	default:
+		fail(`onError`, fmt.Errorf(`onError -> %s is not supported, use %s or %s`, c.OnError, OnErrorContinue, OnErrorExit))
+	}
+	switch c.LocalChanges {
+	case ``:
+		c.LocalChanges = LocalChangesDiscard
+	case LocalChangesDiscard, LocalChangesPreserve, LocalChangesFail, LocalChangesStash:
+	default:
+		fail(`localChanges`, fmt.Errorf(`localChanges -> %s is not supported, use %s, %s, %s or %s`, c.LocalChanges,
+			LocalChangesDiscard, LocalChangesPreserve, LocalChangesFail, LocalChangesStash))
+	}
+	switch c.OnForcePush {
+	case ``:
+		c.OnForcePush = OnForcePushReset
+	case OnForcePushReset, OnForcePushFail:
+	default:
+		fail(`onForcePush`, fmt.Errorf(`onForcePush -> %s is not supported, use %s or %s`, c.OnForcePush, OnForcePushReset, OnForcePushFail))
+	}
+	if c.Clean != nil {
+		if err = c.Clean.Validate(); err != nil {
+			fail(`clean`, fmt.Errorf(`clean -> %s`, err.Error()))
+		}
+	}
+	if c.MaxFailures < 0 {
+		fail(`maxFailures`, fmt.Errorf(`maxFailures -> cannot be negative`))
+	}
+	if c.Retry != nil {
+		if err = c.Retry.Validate(); err != nil {
+			fail(`retry`, fmt.Errorf(`retry -> %s`, err.Error()))
+		}
+	}
+	if c.Publish != nil {
+		if err = c.Publish.Validate(); err != nil {
+			fail(`publish`, fmt.Errorf(`publish -> %s`, err.Error()))
+		} else if len(c.Path) > 0 {
+			path := resolvePath(c.Path)
+			for _, link := range []struct {
+				field    string
+				path     string
+				resolved string
+			}{
+				{`publish.link`, c.Publish.Link, c.Publish.resolvedLink()},
+				{`publish.worktrees`, c.Publish.Worktrees, resolvePath(c.Publish.Worktrees)},
+			} {
+				if link.resolved == path || isSubPath(path, link.resolved) || isSubPath(link.resolved, path) {
+					fail(link.field, fmt.Errorf(`publish -> %s overlaps with the task path`, link.path))
+				}
+			}
+		}
+	}
+	for i, notify := range c.Notify {
+		if err = notify.Validate(); err != nil {
+			fail(fmt.Sprintf(`notify[%d]`, i), fmt.Errorf(`notify[%d] -> %s`, i, err.Error()))
+		}
+	}
+	for i, dir := range c.Sparse {
+		clean := path.Clean(strings.TrimSpace(dir))
+		if clean == `.` || path.IsAbs(clean) || clean == `..` || strings.HasPrefix(clean, `../`) || strings.Contains(clean, `\`) {
+			fail(fmt.Sprintf(`sparse[%d]`, i), fmt.Errorf(`sparse[%d] -> %s is not a relative dir of the repo`, i, dir))
+			continue
+		}
+		c.Sparse[i] = clean
+	}
+	if len(c.Sparse) > 0 {
+		if c.Submodules {
+			fail(`sparse`, fmt.Errorf(`sparse cannot be used with submodules`))
+		}
+		if c.LocalChanges == LocalChangesStash {
+			// go-git cannot write the index of sparse repos
+			fail(`sparse`, fmt.Errorf(`sparse cannot be used with localChanges %s`, LocalChangesStash))
+		}
+	}
+	if c.Verify != nil {
+		if err = c.Verify.Validate(); err != nil {
+			fail(`verify`, fmt.Errorf(`verify -> %s`, err.Error()))
+		}
+	}
+	if c.Hooks != nil {
+		if err = c.Hooks.Validate(); err != nil {
+			fail(`hooks`, fmt.Errorf(`hooks -> %s`, err.Error()))
+		}
 	}
 	if c.Auth != nil {
 		if err = c.Auth.Validate(); err != nil {
-			return err
+			fail(`auth`, err)
+		}
+		// the protocol is unknown if the url is not valid
+		if len(protocol) > 0 {
+			if c.Auth.SSH != nil && protocol != `ssh` {
+				fail(`auth.ssh`, fmt.Errorf(`auth -> ssh -> can be used only with ssh urls`))
+			}
+			if c.Auth.SSH == nil && protocol == `ssh` && (c.Auth.BearerToken != nil || c.Auth.BasicToken != nil || c.Auth.Basic != nil) {
+				fail(`auth`, fmt.Errorf(`auth -> only ssh config can be used with ssh urls`))
+			}
+		}
+		if c.Auth.SSH != nil && len(c.Auth.SSH.User) == 0 && endpoint != nil {
+			c.Auth.SSH.User = endpoint.User
+			if len(c.Auth.SSH.User) == 0 {
+				c.Auth.SSH.User = defaultSshUser
+			}
+		}
+	}
+	return errs
+}
+
+// CheckAll returns all problems of the environment the task runs in: secrets that cannot be read,
+// keys that cannot be parsed and the git cli of sparse tasks. The task has to be validated first.
+func (c *TaskConfig) CheckAll() []error {
+	var errs []error
+	fail := func(field string, err error) {
+		errs = append(errs, &TaskFieldError{Field: field, Err: err})
+	}
+
+	var secrets []configSecret
+	if c.Auth != nil {
+		secrets = append(secrets, c.Auth.secrets()...)
+	}
+	for i, notify := range c.Notify {
+		secrets = append(secrets, notify.secrets(fmt.Sprintf(`notify[%d]`, i))...)
+	}
+	if c.Verify != nil {
+		secrets = append(secrets, c.Verify.secrets()...)
+	}
+	secretsFound := true
+	for _, secret := range secrets {
+		if err := secret.check(); err != nil {
+			fail(secret.field, err)
+			secretsFound = false
+		}
+	}
+
+	if c.Verify != nil && secretsFound {
+		if _, err := c.Verify.Verifier(); err != nil {
+			fail(`verify`, fmt.Errorf(`verify -> %s`, err.Error()))
+		}
+	}
+	if len(c.Sparse) > 0 {
+		if err := CheckSparseSupport(); err != nil {
+			fail(`sparse`, fmt.Errorf(`sparse -> %s`, err.Error()))
+		}
+	}
+	return errs
+}
+
+type Retry struct {
+	InitialDelaySeconds int     `yaml:"initialDelaySeconds" json:"initialDelaySeconds"`
+	Multiplier          float64 `yaml:"multiplier,omitempty" json:"multiplier,omitempty"`
+	MaxDelaySeconds     int     `yaml:"maxDelaySeconds,omitempty" json:"maxDelaySeconds,omitempty"`
+	Jitter              float64 `yaml:"jitter,omitempty" json:"jitter,omitempty"`
+}
+
+func (r *Retry) Validate() error {
+	if r.InitialDelaySeconds < 1 {
+		return errors.New(`initialDelaySeconds -> must be positive`)
+	}
+	if r.Multiplier == 0 {
+		r.Multiplier = defaultRetryMultiplier
+	}
+	if r.Multiplier < 1 {
+		return errors.New(`multiplier -> cannot be less than 1`)
+	}
+	if r.MaxDelaySeconds == 0 {
+		r.MaxDelaySeconds = defaultRetryMaxDelaySeconds
+	}
+	if r.MaxDelaySeconds < r.InitialDelaySeconds {
+		return errors.New(`maxDelaySeconds -> cannot be less than initialDelaySeconds`)
+	}
+	if r.Jitter < 0 || r.Jitter > 1 {
+		return errors.New(`jitter -> must be between 0 and 1`)
+	}
+	return nil
+}
+
+func (r *Retry) Backoff() *Backoff {
+	return &Backoff{
+		InitialDelay: time.Duration(r.InitialDelaySeconds) * time.Second,
+		Multiplier:   r.Multiplier,
+		MaxDelay:     time.Duration(r.MaxDelaySeconds) * time.Second,
+		Jitter:       r.Jitter,
+	}
+}
+
+// Publish makes updates atomic for readers of the link: each revision is exported into
+// its own dir inside Worktrees and the link is switched to it by rename.
+type Publish struct {
+	// Link is the symlink to the current revision
+	Link string `yaml:"link" json:"link"`
+	// Worktrees is the dir of exported revisions, `.worktrees/<link name>` next to the link by default
+	Worktrees string `yaml:"worktrees,omitempty" json:"worktrees,omitempty"`
+	// KeepRevisions is the number of previous revisions that are not deleted, 1 by default
+	KeepRevisions *int `yaml:"keepRevisions,omitempty" json:"keepRevisions,omitempty"`
+}
+
+func (p *Publish) Validate() error {
+	if len(p.Link) == 0 {
+		return errors.New(`link -> is missing`)
+	}
+	if len(p.Worktrees) == 0 {
+		p.Worktrees = filepath.Join(filepath.Dir(p.Link), `.worktrees`, filepath.Base(p.Link))
+	}
+	if p.KeepRevisions == nil {
+		keep := defaultKeepRevisions
+		p.KeepRevisions = &keep
+	}
+	if *p.KeepRevisions < 0 {
+		return errors.New(`keepRevisions -> cannot be negative`)
+	}
+	link, worktrees := p.resolvedLink(), resolvePath(p.Worktrees)
+	if link == worktrees || isSubPath(link, worktrees) || isSubPath(worktrees, link) {
+		return errors.New(`worktrees -> cannot overlap with the link`)
+	}
+	return nil
+}
+
+// Clean defines which files that are not tracked by the repo are deleted.
+type Clean struct {
+	// Mode is none, untracked (default) or untracked+ignored
+	Mode string `yaml:"mode,omitempty" json:"mode,omitempty"`
+	// Exclude is a list of gitignore patterns of files that are never deleted
+	Exclude []string `yaml:"exclude,omitempty" json:"exclude,omitempty"`
+}
+
+func (c *Clean) Validate() error {
+	switch c.Mode {
+	case ``:
+		c.Mode = CleanUntracked
+	case CleanNone, CleanUntracked, CleanUntrackedIgnored:
+	default:
+		return fmt.Errorf(`mode -> %s is not supported, use %s, %s or %s`, c.Mode, CleanNone, CleanUntracked, CleanUntrackedIgnored)
+	}
+	for i, pattern := range c.Exclude {
+		if len(strings.TrimSpace(pattern)) == 0 {
+			return fmt.Errorf(`exclude[%d] -> is empty`, i)
+		}
+	}
+	return nil
+}
+
+// Verify defines keys that are allowed to sign synced revisions.
+type Verify struct {
+	// Gpg is an armored public key ring
+	Gpg *Secret `yaml:"gpg,omitempty" json:"gpg,omitempty"`
+	// SshAllowedSigners has the format of the gpg.ssh.allowedSignersFile git option
+	SshAllowedSigners *Secret `yaml:"sshAllowedSigners,omitempty" json:"sshAllowedSigners,omitempty"`
+}
+
+func (v *Verify) Validate() error {
+	if v.Gpg == nil && v.SshAllowedSigners == nil {
+		return errors.New(`gpg or sshAllowedSigners has to be configured`)
+	}
+	if v.Gpg != nil {
+		if err := v.Gpg.Validate(); err != nil {
+			return fmt.Errorf(`gpg -> %s`, err.Error())
+		}
+	}
+	if v.SshAllowedSigners != nil {
+		if err := v.SshAllowedSigners.Validate(); err != nil {
+			return fmt.Errorf(`sshAllowedSigners -> %s`, err.Error())
+		}
+	}
+	return nil
+}
+
+func (v *Verify) secrets() []configSecret {
+	var secrets []configSecret
+	if v.Gpg != nil {
+		secrets = append(secrets, configSecret{field: `verify.gpg`, name: `verify -> gpg`, secret: v.Gpg})
+	}
+	if v.SshAllowedSigners != nil {
+		secrets = append(secrets, configSecret{field: `verify.sshAllowedSigners`, name: `verify -> sshAllowedSigners`, secret: v.SshAllowedSigners})
+	}
+	return secrets
+}
+
+// Verifier reads the keys, so rotated keys are used without restart.
+func (v *Verify) Verifier() (*SignatureVerifier, error) {
+	gpg, sshAllowedSigners, err := v.keys()
+	if err != nil {
+		return nil, err
+	}
+	return NewSignatureVerifier(gpg, sshAllowedSigners)
+}
+
+// keys reads the gpg key ring and the ssh allowed signers from their secrets.
+func (v *Verify) keys() (gpg string, sshAllowedSigners string, err error) {
+	if v.Gpg != nil {
+		if gpg, err = v.Gpg.GetValue(); err != nil {
+			return ``, ``, fmt.Errorf(`gpg -> %s`, err.Error())
+		}
+	}
+	if v.SshAllowedSigners != nil {
+		if sshAllowedSigners, err = v.SshAllowedSigners.GetValue(); err != nil {
+			return ``, ``, fmt.Errorf(`sshAllowedSigners -> %s`, err.Error())
+		}
+	}
+	return gpg, sshAllowedSigners, nil
+}
+
+// resolvedLink resolves the parent dir of the link, the link itself points to the current revision inside of worktrees.
+func (p *Publish) resolvedLink() string {
+	return filepath.Join(resolvePath(filepath.Dir(p.Link)), filepath.Base(p.Link))
+}
+
+type Hooks struct {
+	// PostSync runs after the sync if HEAD has changed
+	PostSync *Hook `yaml:"postSync,omitempty" json:"postSync,omitempty"`
+}
+
+func (h *Hooks) Validate() error {
+	if h.PostSync != nil {
+		if err := h.PostSync.Validate(); err != nil {
+			return fmt.Errorf(`postSync -> %s`, err.Error())
+		}
+	}
+	return nil
+}
+
+// Hook is a command that is run by the app, its output is written to the log.
+type Hook struct {
+	Command string            `yaml:"command" json:"command"`
+	Args    []string          `yaml:"args,omitempty" json:"args,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	// WorkDir is the working directory, the publish link or the task path by default
+	WorkDir        string `yaml:"workDir,omitempty" json:"workDir,omitempty"`
+	TimeoutSeconds int    `yaml:"timeoutSeconds,omitempty" json:"timeoutSeconds,omitempty"`
+}
+
+func (h *Hook) Validate() error {
+	if len(h.Command) == 0 {
+		return errors.New(`command -> is missing`)
+	}
+	if h.TimeoutSeconds == 0 {
+		h.TimeoutSeconds = defaultHookTimeoutSeconds
+	}
+	if h.TimeoutSeconds < 0 {
+		return errors.New(`timeoutSeconds -> must be positive`)
+	}
+	return nil
+}
+
+// MarshalJSON masks env values, they often contain credentials.
+func (h Hook) MarshalJSON() ([]byte, error) {
+	type hook Hook
+	masked := hook(h)
+	if len(h.Env) > 0 {
+		masked.Env = make(map[string]string, len(h.Env))
+		for key := range h.Env {
+			masked.Env[key] = maskedValue
+		}
+	}
+	return json.Marshal(masked)
+}
+
+func (h *Hook) Timeout() time.Duration {
+	return time.Duration(h.TimeoutSeconds) * time.Second
+}
+
+// Notify is a receiver of sync events, the JSON payload is posted to the Url.
+type Notify struct {
+	Url string `yaml:"url" json:"url"`
+	// Events are names of events that are sent, all events by default
+	Events  []string           `yaml:"events,omitempty" json:"events,omitempty"`
+	Headers map[string]*Secret `yaml:"headers,omitempty" json:"headers,omitempty"`
+	// Secret signs the payload with HMAC SHA256 (X-Git-Sync-Signature-256 header)
+	Secret         *Secret `yaml:"secret,omitempty" json:"secret,omitempty"`
+	TimeoutSeconds int     `yaml:"timeoutSeconds,omitempty" json:"timeoutSeconds,omitempty"`
+	// Retries is the number of retries after a failed delivery, 3 by default
+	Retries *int `yaml:"retries,omitempty" json:"retries,omitempty"`
+}
+
+func (n *Notify) Validate() error {
+	endpoint, err := url.Parse(n.Url)
+	if err != nil || (endpoint.Scheme != `http` && endpoint.Scheme != `https`) || len(endpoint.Host) == 0 {
+		return errors.New(`url -> must be an http(s) url`)
+	}
+	for _, event := range n.Events {
+		switch event {
+		case NotifyEventSynced, NotifyEventFailed, NotifyEventRecovered:
+		default:
+			return fmt.Errorf(`events -> unknown event %s`, event)
+		}
+	}
+	for name, header := range n.Headers {
+		if header == nil {
+			return fmt.Errorf(`headers -> %s -> value is missing`, name)
 		}
+		if err = header.Validate(); err != nil {
+			return fmt.Errorf(`headers -> %s -> %s`, name, err.Error())
+		}
+	}
+	if n.Secret != nil {
+		if err = n.Secret.Validate(); err != nil {
+			return fmt.Errorf(`secret -> %s`, err.Error())
+		}
+	}
+	if n.TimeoutSeconds == 0 {
+		n.TimeoutSeconds = defaultNotifyTimeoutSeconds
+	}
+	if n.TimeoutSeconds < 0 {
+		return errors.New(`timeoutSeconds -> must be positive`)
+	}
+	if n.Retries == nil {
+		retries := defaultNotifyRetries
+		n.Retries = &retries
+	}
+	if *n.Retries < 0 {
+		return errors.New(`retries -> cannot be negative`)
 	}
 	return nil
 }
 
+// secrets returns the secret and the headers (sorted by name) of the receiver, field is the path of the receiver.
+func (n *Notify) secrets(field string) []configSecret {
+	var secrets []configSecret
+	names := make([]string, 0, len(n.Headers))
+	for name := range n.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if header := n.Headers[name]; header != nil {
+			secrets = append(secrets, configSecret{
+				field:  field + `.headers.` + name,
+				name:   field + ` -> headers -> ` + name,
+				secret: header,
+			})
+		}
+	}
+	if n.Secret != nil {
+		secrets = append(secrets, configSecret{field: field + `.secret`, name: field + ` -> secret`, secret: n.Secret})
+	}
+	return secrets
+}
+
+// Accepts checks if the event has to be sent to the receiver.
+func (n *Notify) Accepts(event string) bool {
+	if len(n.Events) == 0 {
+		return true
+	}
+	for _, accepted := range n.Events {
+		if accepted == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *Notify) Timeout() time.Duration {
+	return time.Duration(n.TimeoutSeconds) * time.Second
+}
+
+func (n *Notify) RedactedUrl() string {
+	parsedUrl, err := url.Parse(n.Url)
+	if err != nil {
+		return n.Url
+	}
+	return parsedUrl.Redacted()
+}
+
+// MarshalJSON hides credentials of the url, values of headers are masked by Secret.
+func (n Notify) MarshalJSON() ([]byte, error) {
+	type notify Notify
+	masked := notify(n)
+	masked.Url = n.RedactedUrl()
+	return json.Marshal(masked)
+}
+
 type Auth struct {
-	Validatable
+	Validatable `yaml:"-" json:"-"`
 	BearerToken *Secret `yaml:"bearerToken,omitempty" json:"bearerToken,omitempty"`
 	BasicToken  *Secret `yaml:"basicToken,omitempty" json:"basicToken,omitempty"`
 	Basic       *Basic  `yaml:"basic,omitempty" json:"basic,omitempty"`
+	SSH         *SSH    `yaml:"ssh,omitempty" json:"ssh,omitempty"`
 }
 
 func (auth *Auth) Validate() error {
@@ -134,6 +943,9 @@ func (auth *Auth) Validate() error {
 	if auth.Basic != nil {
 		count++
 	}
+	if auth.SSH != nil {
+		count++
+	}
 	if count > 1 {
 		return errors.New(`auth -> to many configurations`)
 	}
@@ -152,9 +964,35 @@ func (auth *Auth) Validate() error {
 			return fmt.Errorf(`auth -> Basic -> %s`, err.Error())
 		}
 	}
+	if auth.SSH != nil {
+		if err := auth.SSH.Validate(); err != nil {
+			return fmt.Errorf(`auth -> ssh -> %s`, err.Error())
+		}
+	}
 	return nil
 }
 
+func (auth *Auth) secrets() []configSecret {
+	var secrets []configSecret
+	add := func(field string, name string, secret *Secret) {
+		if secret != nil {
+			secrets = append(secrets, configSecret{field: field, name: name, secret: secret})
+		}
+	}
+	add(`auth.bearerToken`, `auth -> BearerToken`, auth.BearerToken)
+	add(`auth.basicToken`, `auth -> BasicToken`, auth.BasicToken)
+	if auth.Basic != nil {
+		add(`auth.basic.user`, `auth -> Basic -> user`, auth.Basic.User)
+		add(`auth.basic.password`, `auth -> Basic -> password`, auth.Basic.Password)
+	}
+	if auth.SSH != nil {
+		add(`auth.ssh.privateKey`, `auth -> ssh -> privateKey`, auth.SSH.PrivateKey)
+		add(`auth.ssh.passphrase`, `auth -> ssh -> passphrase`, auth.SSH.Passphrase)
+		add(`auth.ssh.knownHosts`, `auth -> ssh -> knownHosts`, auth.SSH.KnownHosts)
+	}
+	return secrets
+}
+
 type Basic struct {
 	User     *Secret `yaml:"user,omitempty" json:"user,omitempty"`
 	Password *Secret `yaml:"password,omitempty" json:"password,omitempty"`
@@ -176,6 +1014,55 @@ func (basic *Basic) Validate() error {
 	return nil
 }
 
+type SSH struct {
+	User       string  `yaml:"user,omitempty" json:"user,omitempty"`
+	PrivateKey *Secret `yaml:"privateKey,omitempty" json:"privateKey,omitempty"`
+	Passphrase *Secret `yaml:"passphrase,omitempty" json:"passphrase,omitempty"`
+	KnownHosts *Secret `yaml:"knownHosts,omitempty" json:"knownHosts,omitempty"`
+}
+
+// Validate checks the ssh config, the ssh agent is used if the private key is not set.
+func (s *SSH) Validate() error {
+	if s.PrivateKey != nil {
+		if err := s.PrivateKey.Validate(); err != nil {
+			return fmt.Errorf(`privateKey -> %s`, err.Error())
+		}
+	}
+	if s.Passphrase != nil {
+		if err := s.Passphrase.Validate(); err != nil {
+			return fmt.Errorf(`passphrase -> %s`, err.Error())
+		}
+	}
+	if s.KnownHosts != nil {
+		if err := s.KnownHosts.Validate(); err != nil {
+			return fmt.Errorf(`knownHosts -> %s`, err.Error())
+		}
+	}
+	return nil
+}
+
+func (s *SSH) knownHosts() (string, error) {
+	if s.KnownHosts == nil {
+		return ``, nil
+	}
+	return s.KnownHosts.GetValue()
+}
+
+func (s *SSH) credentials() (privateKey string, passphrase string, err error) {
+	if s.PrivateKey == nil {
+		return ``, ``, ErrSshPrivateKeyIsMissing
+	}
+	if privateKey, err = s.PrivateKey.GetValue(); err != nil {
+		return ``, ``, err
+	}
+	if s.Passphrase != nil {
+		if passphrase, err = s.Passphrase.GetValue(); err != nil {
+			return ``, ``, err
+		}
+	}
+	return privateKey, passphrase, nil
+}
+
 func (auth *Auth) GitOpts() ([]string, error) {
 	if auth.BearerToken != nil {
 		token, err := auth.BearerToken.GetValue()
@@ -232,6 +1119,58 @@ func (auth *Auth) GitOpts() ([]string, error) {
 	return []string{}, nil
 }
 
+// GitEnv returns env variables for the git cli and a cleanup func, that must be called after the git process exits.
+func (auth *Auth) GitEnv() ([]string, func(), error) {
+	cleanup := func() {}
+
+	if auth.SSH != nil {
+		knownHosts, err := auth.SSH.knownHosts()
+		if err != nil {
+			return nil, cleanup, err
+		}
+
+		var tempFiles []string
+		cleanup = func() {
+			for _, file := range tempFiles {
+				if err := os.Remove(file); err != nil {
+					log.WithError(err).WithFields(log.Fields{
+						`path`: file,
+					}).Warn(`unable to remove temporary ssh file`)
+				}
+			}
+		}
+
+		// the default identities and the ssh agent are used without the private key
+		keyFile := ``
+		if auth.SSH.PrivateKey != nil {
+			privateKey, passphrase, err := auth.SSH.credentials()
+			if err != nil {
+				return nil, cleanup, err
+			}
+			if keyFile, err = WriteSshKeyFile([]byte(privateKey), passphrase); err != nil {
+				return nil, cleanup, err
+			}
+			tempFiles = append(tempFiles, keyFile)
+		}
+
+		sshOpts := []string{`StrictHostKeyChecking=yes`}
+		if len(knownHosts) > 0 {
+			knownHostsFile, err := WriteKnownHostsFile([]byte(knownHosts))
+			if err != nil {
+				return nil, cleanup, err
+			}
+			tempFiles = append(tempFiles, knownHostsFile)
+			sshOpts = append(sshOpts, fmt.Sprintf(`UserKnownHostsFile=%s`, knownHostsFile))
+		}
+
+		return []string{
+			fmt.Sprintf(`GIT_SSH_COMMAND=%s`, SshCommand(keyFile, auth.SSH.User, sshOpts...)),
+		}, cleanup, nil
+	}
+
+	return []string{}, cleanup, nil
+}
+
 func (auth *Auth) GitAuth() (gitTransport.AuthMethod, error) {
 
 	if auth.BearerToken != nil {
@@ -277,6 +1216,45 @@ func (auth *Auth) GitAuth() (gitTransport.AuthMethod, error) {
 		}, nil
 	}
 
+	if auth.SSH != nil {
+		user := auth.SSH.User
+		if len(user) == 0 {
+			user = defaultSshUser
+		}
+
+		knownHosts, err := auth.SSH.knownHosts()
+		if err != nil {
+			return nil, err
+		}
+
+		hostKeyCallback, err := NewKnownHostsCallback([]byte(knownHosts))
+		if err != nil {
+			return nil, fmt.Errorf(`unable to load known hosts: %v`, err)
+		}
+
+		// the ssh agent is used without the private key
+		if auth.SSH.PrivateKey == nil {
+			agentAuth, err := gitSsh.NewSSHAgentAuth(user)
+			if err != nil {
+				return nil, err
+			}
+			agentAuth.HostKeyCallback = hostKeyCallback
+			return agentAuth, nil
+		}
+
+		privateKey, passphrase, err := auth.SSH.credentials()
+		if err != nil {
+			return nil, err
+		}
+		publicKeys, err := gitSsh.NewPublicKeys(user, []byte(privateKey), passphrase)
+		if err != nil {
+			return nil, err
+		}
+		publicKeys.HostKeyCallback = hostKeyCallback
+
+		return publicKeys, nil
+	}
+
 	return nil, fmt.Errorf(`auth object is not configured`)
 }
 
@@ -285,6 +1263,41 @@ type Secret struct {
 	ValueFrom *SecretValueFrom `yaml:"valueFrom" json:"valueFrom"`
 }
 
+// configSecret is a secret of the config, field is its path like `auth.basic.user` and name prefixes its problems.
+type configSecret struct {
+	field  string
+	name   string
+	secret *Secret
+}
+
+func (s configSecret) validate() error {
+	if err := s.secret.Validate(); err != nil {
+		return fmt.Errorf(`%s -> %s`, s.name, err.Error())
+	}
+	return nil
+}
+
+func (s configSecret) check() error {
+	if err := s.secret.Check(); err != nil {
+		return fmt.Errorf(`%s -> %s`, s.name, err.Error())
+	}
+	return nil
+}
+
+// MarshalJSON masks the raw value, so the config can be exposed by the http api.
+func (secret Secret) MarshalJSON() ([]byte, error) {
+	masked := struct {
+		Value     string           `json:"value,omitempty"`
+		ValueFrom *SecretValueFrom `json:"valueFrom,omitempty"`
+	}{
+		ValueFrom: secret.ValueFrom,
+	}
+	if len(secret.Value) > 0 {
+		masked.Value = maskedValue
+	}
+	return json.Marshal(masked)
+}
+
 func (secret *Secret) Validate() error {
 	count := 0
 	if len(secret.Value) > 0 {
@@ -322,6 +1335,22 @@ func (valueFrom *SecretValueFrom) Validate() error {
 	if count != 1 {
 		return errors.New(`env end file configs cannot be set simultaneously`)
 	}
+	return nil
+}
+
+// Check tells if the secret can be read: the env variable is set or the file exists.
+func (secret *Secret) Check() error {
+	if secret.ValueFrom != nil {
+		if err := secret.ValueFrom.Check(); err != nil {
+			return fmt.Errorf(`valueFrom -> %s`, err.Error())
+		}
+	}
+	return nil
+}
+
+func (valueFrom *SecretValueFrom) Check() error {
+	env := valueFrom.Env
+	file := valueFrom.File
 	if len(env) > 0 {
 		_, found := os.LookupEnv(env)
 		if !found {
@@ -346,14 +1375,14 @@ func (secret *Secret) GetValue() (string, error) {
 		bytes []byte
 	)
 
-	if len(secret.ValueFrom.File) > 0 {
+	if secret.ValueFrom != nil && len(secret.ValueFrom.File) > 0 {
 		bytes, err = os.ReadFile(secret.ValueFrom.File)
 		if err == nil {
 			return string(bytes), nil
 		}
 	}
 
-	if len(secret.ValueFrom.Env) > 0 {
+	if secret.ValueFrom != nil && len(secret.ValueFrom.Env) > 0 {
 		value, found := os.LookupEnv(secret.ValueFrom.Env)
 		if found {
 			return value, nil
@@ -371,7 +1400,10 @@ func (secret *Secret) GetValue() (string, error) {
 	return "", err
 }
 
-func (c *TaskConfig) GitCloneCmd() (*exec.Cmd, error) {
+// GitCloneCmd prepares the manual `git clone` command.
+// The returned cleanup func must be called after the command exits.
+func (c *TaskConfig) GitCloneCmd() (*exec.Cmd, func(), error) {
+	cleanup := func() {}
 	opts := []string{`clone`}
 	if c.Insecure {
 		opts = append(opts, `-c`, `http.sslVerify=false`)
@@ -388,6 +1420,14 @@ func (c *TaskConfig) GitCloneCmd() (*exec.Cmd, error) {
 	if c.SingleBranch != nil && *c.SingleBranch {
 		opts = append(opts, `--single-branch`)
 	}
+	if len(c.Sparse) > 0 {
+		// only files of the root dir are checked out, the sparse dirs are set after the clone
+		opts = append(opts, `--sparse`)
+	}
+	if c.Verify != nil {
+		// the revision is checked out only after it is verified
+		opts = append(opts, `--no-checkout`)
+	}
 	if len(c.Reference.Branch) > 0 {
 		opts = append(opts, `--branch`, c.Reference.Branch)
 	} else if len(c.Reference.Tag) > 0 {
@@ -402,14 +1442,23 @@ func (c *TaskConfig) GitCloneCmd() (*exec.Cmd, error) {
 			`remote_name`: c.RemoteName,
 		}).Warn(`manual clone. custom remote name will be ignored`)
 	}
-	gitOpts, err := c.Auth.GitOpts()
-	if err != nil {
-		return nil, err
+	var env []string
+	if c.Auth != nil {
+		gitOpts, err := c.Auth.GitOpts()
+		if err != nil {
+			return nil, cleanup, err
+		}
+		opts = append(opts, gitOpts...)
+
+		env, cleanup, err = c.Auth.GitEnv()
+		if err != nil {
+			return nil, cleanup, err
+		}
 	}
-	opts = append(opts, gitOpts...)
 	opts = append(opts, c.Url, c.Path)
 
 	cmd := exec.Command(`git`, opts...)
+	cmd.Env = append(os.Environ(), env...)
 	logWriter := NewLogrusWriter(log.DebugLevel).WithFields(log.Fields{
 		`name`: c.Name,
 		`url`:  c.Url,
@@ -417,9 +1466,151 @@ func (c *TaskConfig) GitCloneCmd() (*exec.Cmd, error) {
 	})
 	cmd.Stderr = logWriter
 	cmd.Stdout = logWriter
-	return cmd, nil
+	return cmd, cleanup, nil
+}
+
+// MatchesRepo returns true if the url points to the same repo as the task url.
+// The scheme, user and .git suffix are ignored, so ssh and http urls of the same repo match.
+func (c *TaskConfig) MatchesRepo(repoUrl string) bool {
+	key := repoKey(repoUrl)
+	return len(key) > 0 && key == repoKey(c.Url)
+}
+
+// MatchesPushedRef returns true if a push of the ref can change the task revision.
+func (c *TaskConfig) MatchesPushedRef(ref string) bool {
+	refName := plumbing.ReferenceName(ref)
+	switch {
+	case len(c.Reference.Commit) > 0:
+		return false
+	case c.TracksTags():
+		return refName.IsTag()
+	case len(c.Reference.Tag) > 0:
+		return refName == plumbing.NewTagReferenceName(c.Reference.Tag)
+	case len(c.Reference.Branch) > 0:
+		return refName == plumbing.NewBranchReferenceName(c.Reference.Branch)
+	default:
+		// the default branch of the remote is not known without a request
+		return refName.IsBranch()
+	}
+}
+
+func repoKey(repoUrl string) string {
+	endpoint, err := gitTransport.NewEndpoint(repoUrl)
+	if err != nil {
+		return ``
+	}
+	path := strings.Trim(endpoint.Path, `/`)
+	path = strings.TrimSuffix(path, `.git`)
+	return strings.ToLower(fmt.Sprintf(`%s/%s`, endpoint.Host, path))
+}
+
+// RedactedUrl returns the repo url without the password.
+func (c *TaskConfig) RedactedUrl() string {
+	parsedUrl, err := url.Parse(c.Url)
+	if err != nil {
+		return c.Url
+	}
+	return parsedUrl.Redacted()
+}
+
+func (c *TaskConfig) remoteName() string {
+	if len(c.RemoteName) > 0 {
+		return c.RemoteName
+	}
+	return git.DefaultRemoteName
+}
+
+// PinnedCommit returns the commit hash if the task is pinned to the exact commit.
+func (c *TaskConfig) PinnedCommit() (plumbing.Hash, bool) {
+	if len(c.Reference.Commit) == 0 {
+		return plumbing.ZeroHash, false
+	}
+	return plumbing.NewHash(c.Reference.Commit), true
+}
+
+// TracksTags returns true if the task follows the newest tag matching semver and/or tagPattern.
+func (c *TaskConfig) TracksTags() bool {
+	return len(c.Reference.Semver) > 0 || len(c.Reference.TagPattern) > 0
+}
+
+func (c *TaskConfig) isSshUrl() bool {
+	endpoint, err := gitTransport.NewEndpoint(c.Url)
+	return err == nil && endpoint.Protocol == `ssh`
+}
+
+// inheritKnownHosts sets the global known hosts if the task does not have its own ones.
+// Tasks without ssh auth get the ssh config without a private key, so the ssh agent is used.
+func (c *TaskConfig) inheritKnownHosts(knownHosts *Secret) {
+	if c.Auth == nil {
+		c.Auth = &Auth{}
+	}
+	if c.Auth.SSH == nil {
+		// other auth configs are rejected for ssh urls by the validation
+		if c.Auth.BearerToken != nil || c.Auth.BasicToken != nil || c.Auth.Basic != nil {
+			return
+		}
+		c.Auth.SSH = &SSH{}
+	}
+	if c.Auth.SSH.KnownHosts == nil {
+		c.Auth.SSH.KnownHosts = knownHosts
+	}
 }
 
+func (c *TaskConfig) TagSelector() (*TagSelector, error) {
+	return NewTagSelector(c.Reference.Semver, c.Reference.TagPattern)
+}
+
+// ownedFields returns paths that are written by the task with their config fields, missing paths are skipped.
+func (c *TaskConfig) ownedFields() []ownedPath {
+	var paths []ownedPath
+	if len(c.Path) > 0 {
+		paths = append(paths, ownedPath{`path`, c.Path, resolvePath(c.Path)})
+	}
+	if c.Publish != nil {
+		if len(c.Publish.Link) > 0 {
+			paths = append(paths, ownedPath{`publish.link`, c.Publish.Link, c.Publish.resolvedLink()})
+		}
+		if len(c.Publish.Worktrees) > 0 {
+			paths = append(paths, ownedPath{`publish.worktrees`, c.Publish.Worktrees, resolvePath(c.Publish.Worktrees)})
+		}
+	}
+	return paths
+}
+
+// ownedPaths returns paths that are written by the task.
+func (c *TaskConfig) ownedPaths() []string {
+	paths := []string{c.Path}
+	if c.Publish != nil {
+		paths = append(paths, c.Publish.Link, c.Publish.Worktrees)
+	}
+	return paths
+}
+
+func (c *TaskConfig) IsReadinessGate() bool {
+	return c.ReadinessGate == nil || *c.ReadinessGate
+}
+
+// FailureLimit returns the number of consecutive failures after which the task gives up, 0 means never.
+func (c *TaskConfig) FailureLimit() int {
+	if c.MaxFailures > 0 {
+		return c.MaxFailures
+	}
+	if c.OnError == OnErrorExit {
+		return 1
+	}
+	return 0
+}
+
+// RetryDelay returns the delay before the next run after the given number of consecutive failures.
+func (c *TaskConfig) RetryDelay(failures int) time.Duration {
+	if c.Retry == nil {
+		return c.Interval()
+	}
+	return c.Retry.Backoff().Delay(failures)
+}
+
+// Interval returns the delay between runs. Cron tasks have no interval, their runs are timed by the cron job
+// and the returned default is never used as a delay.
 func (c *TaskConfig) Interval() time.Duration {
 	seconds := c.IntervalSeconds
 	if seconds <= 0 {
@@ -434,11 +1625,7 @@ func (c *TaskConfig) CloneOptions() (*git.CloneOptions, error) {
 		URL:             c.Url,
 		InsecureSkipTLS: c.Insecure,
 	}
-	remoteName := c.RemoteName
-	if len(remoteName) == 0 {
-		remoteName = git.DefaultRemoteName
-	}
-	op.RemoteName = remoteName
+	op.RemoteName = c.remoteName()
 	if len(c.Reference.Tag) > 0 {
 		op.ReferenceName = plumbing.NewTagReferenceName(c.Reference.Tag)
 	} else if len(c.Reference.Branch) > 0 {
@@ -458,6 +1645,9 @@ func (c *TaskConfig) CloneOptions() (*git.CloneOptions, error) {
 	if c.Submodules {
 		op.RecurseSubmodules = git.DefaultSubmoduleRecursionDepth
 	}
+	// the sparse worktree is checked out by the git cli after the clone,
+	// signed revisions are checked out only after they are verified
+	op.NoCheckout = len(c.Sparse) > 0 || c.Verify != nil
 
 	op.Progress = NewLogrusWriter(log.DebugLevel).WithFields(log.Fields{
 		`url`:      c.Url,
@@ -475,7 +1665,7 @@ func isValidReference(reference string) bool {
 
 func (c *TaskConfig) PullOptions() (*git.PullOptions, error) {
 
-	_, err := url.Parse(c.Url)
+	_, err := gitTransport.NewEndpoint(c.Url)
 	if err != nil {
 		return nil, fmt.Errorf(`GitSyncTask: URL is not valid. %v`, err)
 	}
@@ -483,11 +1673,7 @@ func (c *TaskConfig) PullOptions() (*git.PullOptions, error) {
 	op := git.PullOptions{
 		InsecureSkipTLS: c.Insecure,
 	}
-	remoteName := c.RemoteName
-	if len(remoteName) == 0 {
-		remoteName = git.DefaultRemoteName
-	}
-	op.RemoteName = remoteName
+	op.RemoteName = c.remoteName()
 	if isValidReference(c.Reference.Tag) {
 		op.ReferenceName = plumbing.NewTagReferenceName(c.Reference.Tag)
 	} else if isValidReference(c.Reference.Branch) {
@@ -516,3 +1702,50 @@ func (c *TaskConfig) PullOptions() (*git.PullOptions, error) {
 
 	return &op, nil
 }
+
+// FetchOptions fetches the given ref specs.
+// All branches and tags of the remote are fetched if ref specs are not set.
+func (c *TaskConfig) FetchOptions(refSpecs ...gitConfig.RefSpec) (*git.FetchOptions, error) {
+	var err error
+	remoteName := c.remoteName()
+	if len(refSpecs) == 0 {
+		refSpecs = []gitConfig.RefSpec{
+			gitConfig.RefSpec(fmt.Sprintf(`+refs/heads/*:refs/remotes/%s/*`, remoteName)),
+			gitConfig.RefSpec(`+refs/tags/*:refs/tags/*`),
+		}
+	}
+	op := git.FetchOptions{
+		RemoteName:      remoteName,
+		InsecureSkipTLS: c.Insecure,
+		RefSpecs:        refSpecs,
+	}
+	if c.Auth != nil {
+		if op.Auth, err = c.Auth.GitAuth(); err != nil {
+			return nil, err
+		}
+	}
+	if c.Depth > 0 {
+		op.Depth = c.Depth
+	}
+
+	op.Progress = NewLogrusWriter(log.DebugLevel).WithFields(log.Fields{
+		`url`:      c.Url,
+		`path`:     c.Path,
+		`revision`: refSpecs,
+	})
+
+	return &op, nil
+}
+
+func (c *TaskConfig) ListOptions() (*git.ListOptions, error) {
+	var err error
+	op := git.ListOptions{
+		InsecureSkipTLS: c.Insecure,
+	}
+	if c.Auth != nil {
+		if op.Auth, err = c.Auth.GitAuth(); err != nil {
+			return nil, err
+		}
+	}
+	return &op, nil
+}
@@ -1,8 +1,61 @@
 package errors
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 var (
 	ErrAppIsDone           = errors.New(`app is finished successfully`)
 	ErrGitRepoUrlIsMissing = errors.New(`git repo url is missing`)
+	ErrTaskIsStopped       = errors.New(`task is stopped after too many failures`)
 )
+
+// SshHostKeyError is returned when the ssh server key is not present in known_hosts or does not match it.
+type SshHostKeyError struct {
+	Host        string
+	Fingerprint string
+	Unknown     bool
+	Revoked     bool
+}
+
+func (e *SshHostKeyError) Error() string {
+	switch {
+	case e.Revoked:
+		return fmt.Sprintf(`ssh host key for %s is revoked (%s)`, e.Host, e.Fingerprint)
+	case e.Unknown:
+		return fmt.Sprintf(`ssh host %s is not found in known_hosts (%s)`, e.Host, e.Fingerprint)
+	default:
+		return fmt.Sprintf(`ssh host key for %s does not match known_hosts (%s)`, e.Host, e.Fingerprint)
+	}
+}
+
+// LocalChangesError is returned when the worktree has local changes and the task is configured to fail on them.
+type LocalChangesError struct {
+	Paths []string
+}
+
+func (e *LocalChangesError) Error() string {
+	const maxPaths = 10
+	paths := e.Paths
+	if len(paths) > maxPaths {
+		paths = append(paths[:maxPaths:maxPaths], fmt.Sprintf(`and %d more`, len(e.Paths)-maxPaths))
+	}
+	return fmt.Sprintf(`worktree has local changes: %s`, strings.Join(paths, `, `))
+}
+
+// SignatureError is returned when the synced commit or tag is not signed by an allowed key.
+type SignatureError struct {
+	Object string
+	Sha    string
+	Err    error
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf(`signature of %s %s is not verified: %v`, e.Object, e.Sha, e.Err)
+}
+
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
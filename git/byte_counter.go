@@ -0,0 +1,73 @@
+package git
+
+import (
+	"context"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	gitHttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+type byteCounterKey struct{}
+
+// ByteCounter counts bytes received from http(s) remotes by go-git calls made with its context.
+type ByteCounter struct {
+	bytes int64
+}
+
+func (c *ByteCounter) Add(n int64) {
+	atomic.AddInt64(&c.bytes, n)
+}
+
+// Reset returns the counted bytes and resets the counter.
+func (c *ByteCounter) Reset() int64 {
+	return atomic.SwapInt64(&c.bytes, 0)
+}
+
+// WithByteCounter returns the context that makes http(s) transport count received bytes.
+func WithByteCounter(ctx context.Context, counter *ByteCounter) context.Context {
+	return context.WithValue(ctx, byteCounterKey{}, counter)
+}
+
+// InstallByteCounter replaces go-git http(s) transports with ones that count received bytes.
+// Calls with InsecureSkipTLS are not counted, go-git uses its own client for them instead of the installed one.
+// Other protocols (ssh) are not counted as well.
+func InstallByteCounter() {
+	httpClient := gitHttp.NewClient(&http.Client{
+		Transport: &countingTransport{
+			base: http.DefaultTransport,
+		},
+	})
+	client.InstallProtocol(`http`, httpClient)
+	client.InstallProtocol(`https`, httpClient)
+}
+
+type countingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+	if counter, ok := req.Context().Value(byteCounterKey{}).(*ByteCounter); ok {
+		res.Body = &countingReader{
+			ReadCloser: res.Body,
+			counter:    counter,
+		}
+	}
+	return res, nil
+}
+
+type countingReader struct {
+	io.ReadCloser
+	counter *ByteCounter
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.counter.Add(int64(n))
+	return n, err
+}
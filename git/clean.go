@@ -0,0 +1,141 @@
+package git
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CleanWorktree deletes files that are not tracked by the index of the repo, like `git clean -fd` does.
+// Ignored files are deleted only if removeIgnored is set (`git clean -fdx`), files matched by exclude
+// patterns (gitignore syntax) are kept. Dirs that become empty are deleted as well.
+// Submodules (gitlink entries of the index) and dirs of nested repos are never touched.
+// It returns slash-separated paths of the deleted files and dirs relative to the worktree.
+func CleanWorktree(repo *git.Repository, removeIgnored bool, exclude []string) ([]string, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	tracked := make(map[string]bool, len(idx.Entries))
+	trackedDirs := make(map[string]bool)
+	submodules := make(map[string]bool)
+	for _, entry := range idx.Entries {
+		tracked[entry.Name] = true
+		if entry.Mode == filemode.Submodule {
+			submodules[entry.Name] = true
+		}
+		for dir := pathDir(entry.Name); len(dir) > 0; dir = pathDir(dir) {
+			trackedDirs[dir] = true
+		}
+	}
+
+	ignorePatterns, err := gitignore.ReadPatterns(worktree.Filesystem, nil)
+	if err != nil {
+		return nil, err
+	}
+	ignored := gitignore.NewMatcher(append(ignorePatterns, worktree.Excludes...))
+	excludePatterns := make([]gitignore.Pattern, 0, len(exclude))
+	for _, pattern := range exclude {
+		excludePatterns = append(excludePatterns, gitignore.ParsePattern(pattern, nil))
+	}
+	excluded := gitignore.NewMatcher(excludePatterns)
+
+	root := worktree.Filesystem.Root()
+	var removed, untrackedDirs []string
+	err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		parts := strings.Split(name, `/`)
+
+		if entry.Name() == git.GitDirName {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() && (submodules[name] || isNestedRepo(path)) {
+			return fs.SkipDir
+		}
+		if excluded.Match(parts, entry.IsDir()) {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if entry.IsDir() {
+			if trackedDirs[name] {
+				return nil
+			}
+			if ignored.Match(parts, true) && !removeIgnored {
+				return fs.SkipDir
+			}
+			untrackedDirs = append(untrackedDirs, name)
+			return nil
+		}
+
+		if tracked[name] || (ignored.Match(parts, false) && !removeIgnored) {
+			return nil
+		}
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+		removed = append(removed, name)
+		return nil
+	})
+	if err != nil {
+		return removed, err
+	}
+
+	// nested dirs go first, so their parents can become empty
+	sort.Sort(sort.Reverse(sort.StringSlice(untrackedDirs)))
+	for _, name := range untrackedDirs {
+		dir := filepath.Join(root, filepath.FromSlash(name))
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return removed, err
+		}
+		if len(entries) > 0 {
+			continue
+		}
+		if err = os.Remove(dir); err != nil {
+			return removed, err
+		}
+		removed = append(removed, name+`/`)
+	}
+
+	sort.Strings(removed)
+	return removed, nil
+}
+
+// isNestedRepo reports if the dir has its own .git dir (or the .git file of a submodule or a linked worktree).
+func isNestedRepo(dir string) bool {
+	_, err := os.Lstat(filepath.Join(dir, git.GitDirName))
+	return err == nil
+}
+
+func pathDir(name string) string {
+	if i := strings.LastIndex(name, `/`); i >= 0 {
+		return name[:i]
+	}
+	return ``
+}
@@ -0,0 +1,164 @@
+package git
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, root string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		path := filepath.Join(root, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(file+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newCleanRepo creates a repo with tracked files, the libs/sub submodule and the vendor/nested repo,
+// each of them has untracked files inside.
+func newCleanRepo(t *testing.T) (*git.Repository, string) {
+	t.Helper()
+	root := t.TempDir()
+	repo, err := git.PlainInit(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, root, `.gitignore`, `README.md`, `src/main.go`)
+	if err = os.WriteFile(filepath.Join(root, `.gitignore`), []byte("build/\n*.log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{`.gitignore`, `README.md`, `src/main.go`} {
+		if _, err = worktree.Add(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the submodule is a gitlink entry of the index, its dir has the .git file
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Entries = append(idx.Entries, &index.Entry{
+		Name: `libs/sub`,
+		Mode: filemode.Submodule,
+		Hash: plumbing.NewHash(`9f2a3c4b5d6e7f8091a2b3c4d5e6f708192a3b4c`),
+	})
+	if err = repo.Storer.SetIndex(idx); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, root, `libs/sub/.git`, `libs/sub/lib.go`, `libs/sub/untracked.txt`)
+
+	signature := &object.Signature{Name: `test`, Email: `test@example.com`, When: time.Now()}
+	if _, err = worktree.Commit(`init`, &git.CommitOptions{Author: signature, Committer: signature}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = git.PlainInit(filepath.Join(root, `vendor/nested`), false); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, root,
+		`vendor/nested/file.go`,
+		`untracked.txt`,
+		`src/generated.go`,
+		`tmp/a/b.txt`,
+		`app.log`,
+		`build/out.bin`,
+		`data.keep`,
+	)
+	return repo, root
+}
+
+func listFiles(t *testing.T, root string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == `.git` {
+			return filepath.SkipDir
+		}
+		if !entry.IsDir() && entry.Name() != `.git` {
+			rel, _ := filepath.Rel(root, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestCleanWorktree(t *testing.T) {
+	kept := []string{
+		`.gitignore`,
+		`README.md`,
+		`libs/sub/lib.go`,
+		`libs/sub/untracked.txt`,
+		`src/main.go`,
+		`vendor/nested/file.go`,
+	}
+
+	tests := []struct {
+		name          string
+		removeIgnored bool
+		exclude       []string
+		removed       []string
+		kept          []string
+	}{
+		{
+			name:    `untracked`,
+			removed: []string{`data.keep`, `src/generated.go`, `tmp/`, `tmp/a/`, `tmp/a/b.txt`, `untracked.txt`},
+			kept:    append([]string{`app.log`, `build/out.bin`}, kept...),
+		},
+		{
+			name:          `untracked and ignored`,
+			removeIgnored: true,
+			removed:       []string{`app.log`, `build/`, `build/out.bin`, `data.keep`, `src/generated.go`, `tmp/`, `tmp/a/`, `tmp/a/b.txt`, `untracked.txt`},
+			kept:          kept,
+		},
+		{
+			name:          `exclude`,
+			removeIgnored: true,
+			exclude:       []string{`*.keep`, `tmp/`},
+			removed:       []string{`app.log`, `build/`, `build/out.bin`, `src/generated.go`, `untracked.txt`},
+			kept:          append([]string{`data.keep`, `tmp/a/b.txt`}, kept...),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo, root := newCleanRepo(t)
+			removed, err := CleanWorktree(repo, test.removeIgnored, test.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(removed, test.removed) {
+				t.Errorf("removed:\n%s\nexpected:\n%s", strings.Join(removed, "\n"), strings.Join(test.removed, "\n"))
+			}
+			sort.Strings(test.kept)
+			if files := listFiles(t, root); !reflect.DeepEqual(files, test.kept) {
+				t.Errorf("files:\n%s\nexpected:\n%s", strings.Join(files, "\n"), strings.Join(test.kept, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package git
+
+import (
+	"errors"
+	gitSsh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"net"
+	"os"
+	. "registry.fozzy.lan/palefat/git-sync-go/errors"
+)
+
+// WriteKnownHostsFile stores known_hosts content in a temp file that can be passed to `ssh -o UserKnownHostsFile`.
+func WriteKnownHostsFile(content []byte) (string, error) {
+	return writeTempFile(`git-sync-known-hosts-*`, content)
+}
+
+// NewKnownHostsCallback creates a strict host key callback.
+// If content is empty, default known_hosts files are used (see $SSH_KNOWN_HOSTS).
+func NewKnownHostsCallback(content []byte) (ssh.HostKeyCallback, error) {
+	var (
+		callback ssh.HostKeyCallback
+		err      error
+	)
+
+	if len(content) > 0 {
+		var file string
+		if file, err = WriteKnownHostsFile(content); err != nil {
+			return nil, err
+		}
+		callback, err = knownhosts.New(file)
+		_ = os.Remove(file)
+	} else {
+		callback, err = gitSsh.NewKnownHostsCallback()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			return &SshHostKeyError{
+				Host:        hostname,
+				Fingerprint: ssh.FingerprintSHA256(key),
+				Unknown:     len(keyErr.Want) == 0,
+			}
+		}
+
+		var revokedErr *knownhosts.RevokedError
+		if errors.As(err, &revokedErr) {
+			return &SshHostKeyError{
+				Host:        hostname,
+				Fingerprint: ssh.FingerprintSHA256(key),
+				Revoked:     true,
+			}
+		}
+
+		return err
+	}, nil
+}
@@ -0,0 +1,161 @@
+package git
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const tempSuffix = `.tmp`
+
+// ExportCommit writes files of the commit into the new dir, only files of the sparse cone are written if sparse dirs are set.
+// Files are written into a temp dir first, so the dir never contains a partial tree.
+func ExportCommit(commit *object.Commit, dir string, sparse []string) error {
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+	tempDir, err := os.MkdirTemp(filepath.Dir(dir), filepath.Base(dir)+`-*`+tempSuffix)
+	if err != nil {
+		return err
+	}
+
+	err = tree.Files().ForEach(func(file *object.File) error {
+		if len(sparse) > 0 && !InSparseCone(file.Name, sparse) {
+			return nil
+		}
+		return exportFile(file, filepath.Join(tempDir, filepath.FromSlash(file.Name)))
+	})
+	if err == nil {
+		err = os.Chmod(tempDir, 0755)
+	}
+	if err == nil {
+		err = os.Rename(tempDir, dir)
+	}
+	if err != nil {
+		_ = os.RemoveAll(tempDir)
+		return err
+	}
+	return nil
+}
+
+func exportFile(file *object.File, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if file.Mode == filemode.Symlink {
+		target, err := file.Contents()
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, path)
+	}
+
+	perm := os.FileMode(0644)
+	if file.Mode == filemode.Executable {
+		perm = 0755
+	}
+
+	reader, err := file.Reader()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, reader)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// SwapSymlink atomically points the link to the target, the link is replaced by rename(2).
+func SwapSymlink(link string, target string) error {
+	if stat, err := os.Lstat(link); err == nil && stat.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf(`%s exists and it is not a symlink`, link)
+	}
+
+	tempLink := link + tempSuffix
+	_ = os.Remove(tempLink)
+	if err := os.Symlink(target, tempLink); err != nil {
+		return err
+	}
+	if err := os.Rename(tempLink, link); err != nil {
+		_ = os.Remove(tempLink)
+		return err
+	}
+	return nil
+}
+
+// RemoveOldRevisions deletes revision dirs except the current one and the newest keep ones.
+// Leftovers of interrupted exports are deleted as well.
+func RemoveOldRevisions(dir string, current string, keep int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type revision struct {
+		name    string
+		modTime int64
+	}
+	revisions := make([]revision, 0, len(entries))
+	var removed []string
+	remove := func(name string) error {
+		if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+		removed = append(removed, name)
+		return nil
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == current || !entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, tempSuffix) {
+			if err = remove(name); err != nil {
+				return removed, err
+			}
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return removed, err
+		}
+		revisions = append(revisions, revision{
+			name:    name,
+			modTime: info.ModTime().UnixNano(),
+		})
+	}
+
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].modTime > revisions[j].modTime
+	})
+	for i, rev := range revisions {
+		if i < keep {
+			continue
+		}
+		if err = remove(rev.name); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
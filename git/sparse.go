@@ -0,0 +1,123 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// go-git does not support sparse checkouts, so the worktree of sparse repos is updated by the git cli.
+// The cli respects skip-worktree entries of the index, files outside of the sparse dirs are never written.
+
+// minSparseGitVersion is the first git version with the cone mode of `git sparse-checkout`.
+var minSparseGitVersion = [2]int{2, 25}
+
+var (
+	sparseSupportOnce sync.Once
+	sparseSupportErr  error
+)
+
+// CheckSparseSupport checks that the git cli is installed and supports cone mode sparse checkouts.
+// The version is checked once, the result is reused.
+func CheckSparseSupport() error {
+	sparseSupportOnce.Do(func() {
+		var stdout bytes.Buffer
+		cmd := exec.Command(`git`, `--version`)
+		cmd.Stdout = &stdout
+		if err := cmd.Run(); err != nil {
+			sparseSupportErr = fmt.Errorf(`git cli is required: %v`, err)
+			return
+		}
+		major, minor, err := parseGitVersion(stdout.String())
+		if err != nil {
+			sparseSupportErr = err
+			return
+		}
+		if major < minSparseGitVersion[0] || (major == minSparseGitVersion[0] && minor < minSparseGitVersion[1]) {
+			sparseSupportErr = fmt.Errorf(`git %d.%d is too old, %d.%d or newer is required`,
+				major, minor, minSparseGitVersion[0], minSparseGitVersion[1])
+		}
+	})
+	return sparseSupportErr
+}
+
+// parseGitVersion parses the output of `git --version` like `git version 2.39.2 (Apple Git-143)`.
+func parseGitVersion(output string) (int, int, error) {
+	fields := strings.Fields(output)
+	if len(fields) < 3 || fields[0] != `git` || fields[1] != `version` {
+		return 0, 0, fmt.Errorf(`unexpected git version %q`, strings.TrimSpace(output))
+	}
+	parts := strings.SplitN(fields[2], `.`, 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf(`unexpected git version %q`, fields[2])
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf(`unexpected git version %q`, fields[2])
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf(`unexpected git version %q`, fields[2])
+	}
+	return major, minor, nil
+}
+
+// SparseCheckout enables the cone mode sparse checkout of the dirs and updates the worktree.
+func SparseCheckout(ctx context.Context, repoDir string, dirs []string) error {
+	// sparse-checkout keeps its config in the worktree config extension, git ignores it if the repo format
+	// version is not set, and go-git does not set it
+	if err := runGit(ctx, repoDir, `config`, `--get`, `core.repositoryformatversion`); err != nil {
+		if err = runGit(ctx, repoDir, `config`, `core.repositoryformatversion`, `0`); err != nil {
+			return err
+		}
+	}
+	args := append([]string{`sparse-checkout`, `set`, `--cone`, `--`}, dirs...)
+	return runGit(ctx, repoDir, args...)
+}
+
+// SparseReset moves the current branch (or the detached HEAD) to the commit, like `git reset`.
+func SparseReset(ctx context.Context, repoDir string, commit string, hard bool) error {
+	mode := `--mixed`
+	if hard {
+		mode = `--hard`
+	}
+	return runGit(ctx, repoDir, `reset`, `--quiet`, mode, commit)
+}
+
+// SparseCheckoutCommit detaches HEAD at the commit and discards local changes.
+func SparseCheckoutCommit(ctx context.Context, repoDir string, commit string) error {
+	return runGit(ctx, repoDir, `checkout`, `--quiet`, `--force`, `--detach`, commit)
+}
+
+// InSparseCone reports if the slash-separated file path is checked out by the cone mode sparse checkout
+// of the dirs: files of the root dir, files directly in parents of the dirs and all files inside the dirs.
+func InSparseCone(name string, dirs []string) bool {
+	parent := path.Dir(name)
+	if parent == `.` {
+		return true
+	}
+	for _, dir := range dirs {
+		if strings.HasPrefix(name, dir+`/`) || dir == parent || strings.HasPrefix(dir, parent+`/`) {
+			return true
+		}
+	}
+	return false
+}
+
+func runGit(ctx context.Context, repoDir string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, `git`, append([]string{`-C`, repoDir}, args...)...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); len(message) > 0 {
+			return fmt.Errorf(`git %s: %v: %s`, args[0], err, message)
+		}
+		return fmt.Errorf(`git %s: %v`, args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestInSparseCone(t *testing.T) {
+	dirs := []string{`services/api`, `libs/common`}
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: `README.md`, want: true},
+		{name: `services/api/main.go`, want: true},
+		{name: `services/api/internal/handler.go`, want: true},
+		{name: `services/go.mod`, want: true},
+		{name: `libs/common/util.go`, want: true},
+		{name: `libs/README.md`, want: true},
+		{name: `services/web/main.go`, want: false},
+		{name: `services/api2/main.go`, want: false},
+		{name: `docs/index.md`, want: false},
+		{name: `libs/other/util.go`, want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := InSparseCone(test.name, dirs); got != test.want {
+				t.Errorf(`InSparseCone(%q) = %v, want %v`, test.name, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseGitVersion(t *testing.T) {
+	tests := []struct {
+		output string
+		major  int
+		minor  int
+		err    bool
+	}{
+		{output: "git version 2.39.2\n", major: 2, minor: 39},
+		{output: `git version 2.25.0`, major: 2, minor: 25},
+		{output: `git version 2.30.1 (Apple Git-130)`, major: 2, minor: 30},
+		{output: `git version 2.41.0.windows.1`, major: 2, minor: 41},
+		{output: `git version 1.8`, major: 1, minor: 8},
+		{output: `git version 2`, err: true},
+		{output: `git version x.y`, err: true},
+		{output: `hub version 2.14.2`, err: true},
+		{output: ``, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.output, func(t *testing.T) {
+			major, minor, err := parseGitVersion(test.output)
+			if test.err {
+				if err == nil {
+					t.Errorf(`error is expected, got %d.%d`, major, minor)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if major != test.major || minor != test.minor {
+				t.Errorf(`got %d.%d, want %d.%d`, major, minor, test.major, test.minor)
+			}
+		})
+	}
+}
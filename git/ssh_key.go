@@ -0,0 +1,78 @@
+package git
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"os"
+	"strings"
+)
+
+// WriteSshKeyFile stores the private key in a temp file that can be passed to `ssh -i`.
+// Encrypted keys are decrypted with the passphrase, because ssh cannot ask for it in the background.
+func WriteSshKeyFile(privateKey []byte, passphrase string) (string, error) {
+	content := privateKey
+	if len(passphrase) > 0 {
+		key, err := ssh.ParseRawPrivateKeyWithPassphrase(privateKey, []byte(passphrase))
+		if err != nil {
+			return ``, err
+		}
+		if edKey, ok := key.(*ed25519.PrivateKey); ok {
+			key = *edKey
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return ``, fmt.Errorf(`unable to decrypt ssh private key: %v`, err)
+		}
+		content = pem.EncodeToMemory(&pem.Block{
+			Type:  `PRIVATE KEY`,
+			Bytes: der,
+		})
+	}
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		content = append(content, '\n')
+	}
+
+	return writeTempFile(`git-sync-ssh-key-*`, content)
+}
+
+func writeTempFile(pattern string, content []byte) (string, error) {
+	file, err := os.CreateTemp(``, pattern)
+	if err != nil {
+		return ``, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	if err = file.Chmod(0600); err == nil {
+		_, err = file.Write(content)
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return ``, err
+	}
+
+	return file.Name(), nil
+}
+
+// SshCommand builds the value for the GIT_SSH_COMMAND env variable, default identities are used without the key file.
+func SshCommand(keyFile string, user string, opts ...string) string {
+	args := []string{`ssh`}
+	if len(keyFile) > 0 {
+		args = append(args, `-i`, shellQuote(keyFile), `-o`, `IdentitiesOnly=yes`)
+	}
+	if len(user) > 0 {
+		args = append(args, `-l`, shellQuote(user))
+	}
+	for _, opt := range opts {
+		args = append(args, `-o`, shellQuote(opt))
+	}
+	return strings.Join(args, ` `)
+}
+
+func shellQuote(value string) string {
+	return `'` + strings.ReplaceAll(value, `'`, `'\''`) + `'`
+}
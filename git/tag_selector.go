@@ -0,0 +1,70 @@
+package git
+
+import (
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"path"
+)
+
+// TagSelector picks the newest tag that matches a semver constraint and/or a glob pattern.
+type TagSelector struct {
+	constraint *semver.Constraints
+	pattern    string
+}
+
+func NewTagSelector(constraint string, pattern string) (*TagSelector, error) {
+	selector := &TagSelector{
+		pattern: pattern,
+	}
+	if len(constraint) > 0 {
+		c, err := semver.NewConstraint(constraint)
+		if err != nil {
+			return nil, fmt.Errorf(`semver -> %v`, err)
+		}
+		selector.constraint = c
+	}
+	if len(pattern) > 0 {
+		if _, err := path.Match(pattern, ``); err != nil {
+			return nil, fmt.Errorf(`tagPattern -> %v`, err)
+		}
+	}
+	return selector, nil
+}
+
+// Select returns the highest semver tag among the matching ones.
+// Tags that cannot be parsed as semver are ignored.
+func (s *TagSelector) Select(tags []string) (string, bool) {
+	var (
+		bestTag     string
+		bestVersion *semver.Version
+	)
+	for _, tag := range tags {
+		if len(s.pattern) > 0 {
+			if matched, _ := path.Match(s.pattern, tag); !matched {
+				continue
+			}
+		}
+		version, err := semver.NewVersion(tag)
+		if err != nil {
+			continue
+		}
+		if s.constraint != nil && !s.constraint.Check(version) {
+			continue
+		}
+		if bestVersion == nil || version.GreaterThan(bestVersion) {
+			bestTag = tag
+			bestVersion = version
+		}
+	}
+	return bestTag, bestVersion != nil
+}
+
+func (s *TagSelector) String() string {
+	if s.constraint != nil && len(s.pattern) > 0 {
+		return fmt.Sprintf(`%s (%s)`, s.pattern, s.constraint)
+	}
+	if s.constraint != nil {
+		return s.constraint.String()
+	}
+	return s.pattern
+}
@@ -0,0 +1,84 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestTagSelector_Select(t *testing.T) {
+	tags := []string{
+		`v1.0.0`,
+		`v1.2.0`,
+		`v1.10.0`,
+		`v2.0.0-rc.1`,
+		`v1.11.0-beta.2`,
+		`release-2024`,
+		`latest`,
+		`1.9.0`,
+		`v0.9`,
+	}
+
+	tests := []struct {
+		name       string
+		constraint string
+		pattern    string
+		tags       []string
+		want       string
+		found      bool
+	}{
+		{name: `highest release`, constraint: `>= 1.0.0`, tags: tags, want: `v1.10.0`, found: true},
+		{name: `numeric order, not lexical`, constraint: `~1`, tags: []string{`v1.9.0`, `v1.10.0`, `v1.2.0`}, want: `v1.10.0`, found: true},
+		{name: `caret`, constraint: `^1.2`, tags: tags, want: `v1.10.0`, found: true},
+		{name: `tilde`, constraint: `~1.2.0`, tags: tags, want: `v1.2.0`, found: true},
+		{name: `upper bound`, constraint: `< 1.5`, tags: tags, want: `v1.2.0`, found: true},
+		{name: `short version`, constraint: `< 1`, tags: tags, want: `v0.9`, found: true},
+		{name: `prereleases are excluded by release constraints`, constraint: `>= 1.10.0`, tags: tags, want: `v1.10.0`, found: true},
+		{name: `prerelease constraint`, constraint: `>= 2.0.0-0`, tags: tags, want: `v2.0.0-rc.1`, found: true},
+		{name: `prerelease is lower than the release`, constraint: `>= 2.0.0-0`, tags: append([]string{`v2.0.0`}, tags...), want: `v2.0.0`, found: true},
+		{name: `prereleases without constraint`, pattern: `v*`, tags: tags, want: `v2.0.0-rc.1`, found: true},
+		{name: `pattern and constraint`, constraint: `1.x`, pattern: `v*`, tags: tags, want: `v1.10.0`, found: true},
+		{name: `pattern without v`, pattern: `[0-9]*`, tags: tags, want: `1.9.0`, found: true},
+		{name: `non-semver tags are ignored`, pattern: `*`, tags: []string{`latest`, `release-2024`, `v1.0.0`}, want: `v1.0.0`, found: true},
+		{name: `only non-semver tags`, pattern: `*`, tags: []string{`latest`, `release-2024`, `stable`}},
+		{name: `nothing satisfies the constraint`, constraint: `>= 3`, tags: tags},
+		{name: `nothing matches the pattern`, pattern: `release/*`, tags: tags},
+		{name: `no tags`, constraint: `*`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selector, err := NewTagSelector(test.constraint, test.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tag, found := selector.Select(test.tags)
+			if tag != test.want || found != test.found {
+				t.Errorf(`Select() = %q, %v, want %q, %v`, tag, found, test.want, test.found)
+			}
+		})
+	}
+}
+
+func TestNewTagSelector(t *testing.T) {
+	tests := []struct {
+		name       string
+		constraint string
+		pattern    string
+		err        bool
+	}{
+		{name: `empty`},
+		{name: `constraint`, constraint: `>= 1.2, < 2`},
+		{name: `pattern`, pattern: `v1.*`},
+		{name: `bad constraint`, constraint: `>>1`, err: true},
+		{name: `bad pattern`, pattern: `v[1`, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewTagSelector(test.constraint, test.pattern)
+			if test.err && err == nil {
+				t.Error(`error is expected`)
+			}
+			if !test.err && err != nil {
+				t.Errorf(`unexpected error: %v`, err)
+			}
+		})
+	}
+}
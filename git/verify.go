@@ -0,0 +1,257 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+	"hash"
+	"io"
+	"strings"
+)
+
+const (
+	pgpSignatureBegin = `-----BEGIN PGP SIGNATURE-----`
+	sshSignatureBegin = `-----BEGIN SSH SIGNATURE-----`
+	sshSignatureMagic = `SSHSIG`
+	// sshSignatureNamespace is the namespace git uses to sign commits and tags with ssh keys
+	sshSignatureNamespace = `git`
+)
+
+var (
+	ErrSignatureIsMissing     = errors.New(`object is not signed`)
+	ErrSignatureIsUnsupported = errors.New(`signature type is not supported`)
+	ErrSignerIsNotAllowed     = errors.New(`signing key is not allowed`)
+)
+
+// SignatureVerifier checks that commits and tags are signed by one of the allowed gpg or ssh keys.
+type SignatureVerifier struct {
+	gpgKeyRing openpgp.EntityList
+	sshSigners []sshSigner
+}
+
+type sshSigner struct {
+	principals string
+	key        ssh.PublicKey
+	namespaces []string
+}
+
+// NewSignatureVerifier parses the armored gpg key ring and ssh allowed signers (the format of
+// gpg.ssh.allowedSignersFile of git), any of them can be empty.
+func NewSignatureVerifier(gpgKeyRing string, sshAllowedSigners string) (*SignatureVerifier, error) {
+	verifier := &SignatureVerifier{}
+	if len(strings.TrimSpace(gpgKeyRing)) > 0 {
+		keyRing, err := openpgp.ReadArmoredKeyRing(strings.NewReader(gpgKeyRing))
+		if err != nil {
+			return nil, fmt.Errorf(`gpg -> %v`, err)
+		}
+		verifier.gpgKeyRing = keyRing
+	}
+	if len(strings.TrimSpace(sshAllowedSigners)) > 0 {
+		signers, err := parseAllowedSigners(sshAllowedSigners)
+		if err != nil {
+			return nil, fmt.Errorf(`sshAllowedSigners -> %v`, err)
+		}
+		verifier.sshSigners = signers
+	}
+	return verifier, nil
+}
+
+// VerifyCommit checks the signature of the commit and returns the signer.
+func (v *SignatureVerifier) VerifyCommit(commit *object.Commit) (string, error) {
+	encoded := &plumbing.MemoryObject{}
+	if err := commit.EncodeWithoutSignature(encoded); err != nil {
+		return ``, err
+	}
+	return v.verify(commit.PGPSignature, encoded)
+}
+
+// VerifyTag checks the signature of the annotated tag and returns the signer.
+func (v *SignatureVerifier) VerifyTag(tag *object.Tag) (string, error) {
+	signature := tag.PGPSignature
+	unsigned := *tag
+	// go-git splits only pgp signatures from the tag message
+	if len(signature) == 0 {
+		if i := strings.Index(tag.Message, sshSignatureBegin); i >= 0 {
+			signature = tag.Message[i:]
+			unsigned.Message = tag.Message[:i]
+		}
+	}
+	encoded := &plumbing.MemoryObject{}
+	if err := unsigned.EncodeWithoutSignature(encoded); err != nil {
+		return ``, err
+	}
+	return v.verify(signature, encoded)
+}
+
+func (v *SignatureVerifier) verify(signature string, encoded *plumbing.MemoryObject) (string, error) {
+	reader, err := encoded.Reader()
+	if err != nil {
+		return ``, err
+	}
+	payload, err := io.ReadAll(reader)
+	if err != nil {
+		return ``, err
+	}
+
+	switch {
+	case len(signature) == 0:
+		return ``, ErrSignatureIsMissing
+	case strings.Contains(signature, sshSignatureBegin):
+		return v.verifySsh(signature, payload)
+	case strings.Contains(signature, pgpSignatureBegin):
+		return v.verifyGpg(signature, payload)
+	default:
+		return ``, ErrSignatureIsUnsupported
+	}
+}
+
+func (v *SignatureVerifier) verifyGpg(signature string, payload []byte) (string, error) {
+	if len(v.gpgKeyRing) == 0 {
+		return ``, fmt.Errorf(`%w: gpg keys are not configured`, ErrSignerIsNotAllowed)
+	}
+	entity, err := openpgp.CheckArmoredDetachedSignature(v.gpgKeyRing, bytes.NewReader(payload), strings.NewReader(signature), nil)
+	if err != nil {
+		return ``, err
+	}
+	if identity := entity.PrimaryIdentity(); identity != nil {
+		return identity.Name, nil
+	}
+	return entity.PrimaryKey.KeyIdString(), nil
+}
+
+// sshSignature is the blob of the ssh signature, see PROTOCOL.sshsig of openssh.
+type sshSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      []byte
+	HashAlgorithm string
+	Signature     []byte
+}
+
+type sshSignedData struct {
+	Namespace     string
+	Reserved      []byte
+	HashAlgorithm string
+	Hash          []byte
+}
+
+func (v *SignatureVerifier) verifySsh(signature string, payload []byte) (string, error) {
+	if len(v.sshSigners) == 0 {
+		return ``, fmt.Errorf(`%w: ssh allowed signers are not configured`, ErrSignerIsNotAllowed)
+	}
+
+	block, _ := pem.Decode([]byte(signature[strings.Index(signature, sshSignatureBegin):]))
+	if block == nil || !bytes.HasPrefix(block.Bytes, []byte(sshSignatureMagic)) {
+		return ``, errors.New(`ssh signature is malformed`)
+	}
+	var sig sshSignature
+	if err := ssh.Unmarshal(block.Bytes[len(sshSignatureMagic):], &sig); err != nil {
+		return ``, fmt.Errorf(`ssh signature is malformed: %v`, err)
+	}
+	if sig.Version != 1 {
+		return ``, fmt.Errorf(`ssh signature version %d is not supported`, sig.Version)
+	}
+	if sig.Namespace != sshSignatureNamespace {
+		return ``, fmt.Errorf(`ssh signature namespace %s is not %s`, sig.Namespace, sshSignatureNamespace)
+	}
+
+	var h hash.Hash
+	switch sig.HashAlgorithm {
+	case `sha256`:
+		h = sha256.New()
+	case `sha512`:
+		h = sha512.New()
+	default:
+		return ``, fmt.Errorf(`ssh signature hash %s is not supported`, sig.HashAlgorithm)
+	}
+	h.Write(payload)
+
+	key, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return ``, err
+	}
+	var signer *sshSigner
+	for i := range v.sshSigners {
+		if bytes.Equal(v.sshSigners[i].key.Marshal(), key.Marshal()) && v.sshSigners[i].allows(sig.Namespace) {
+			signer = &v.sshSigners[i]
+			break
+		}
+	}
+	if signer == nil {
+		return ``, fmt.Errorf(`%w: %s`, ErrSignerIsNotAllowed, ssh.FingerprintSHA256(key))
+	}
+
+	var sshSig ssh.Signature
+	if err = ssh.Unmarshal(sig.Signature, &sshSig); err != nil {
+		return ``, fmt.Errorf(`ssh signature is malformed: %v`, err)
+	}
+	signed := append([]byte(sshSignatureMagic), ssh.Marshal(sshSignedData{
+		Namespace:     sig.Namespace,
+		Reserved:      sig.Reserved,
+		HashAlgorithm: sig.HashAlgorithm,
+		Hash:          h.Sum(nil),
+	})...)
+	if err = key.Verify(signed, &sshSig); err != nil {
+		return ``, err
+	}
+	return fmt.Sprintf(`%s %s`, signer.principals, ssh.FingerprintSHA256(key)), nil
+}
+
+func (s *sshSigner) allows(namespace string) bool {
+	if len(s.namespaces) == 0 {
+		return true
+	}
+	for _, allowed := range s.namespaces {
+		if allowed == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAllowedSigners parses lines like `principals [options] keytype base64-key [comment]`,
+// only the namespaces option is supported.
+func parseAllowedSigners(content string) ([]sshSigner, error) {
+	var signers []sshSigner
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, `#`) {
+			continue
+		}
+		fields := strings.SplitN(text, ` `, 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf(`line %d: public key is missing`, line)
+		}
+		key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf(`line %d: %v`, line, err)
+		}
+		signer := sshSigner{
+			principals: fields[0],
+			key:        key,
+		}
+		for _, option := range options {
+			name, value, _ := strings.Cut(option, `=`)
+			switch strings.ToLower(name) {
+			case `namespaces`:
+				signer.namespaces = strings.Split(strings.Trim(value, `"`), `,`)
+			case `cert-authority`, `valid-after`, `valid-before`:
+				return nil, fmt.Errorf(`line %d: option %s is not supported`, line, name)
+			}
+		}
+		signers = append(signers, signer)
+	}
+	return signers, scanner.Err()
+}
@@ -0,0 +1,362 @@
+package git
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type gpgKey struct {
+	entity *openpgp.Entity
+	public string
+}
+
+func newGpgKey(t *testing.T, name string) *gpgKey {
+	t.Helper()
+	entity, err := openpgp.NewEntity(name, ``, name+`@example.com`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var public bytes.Buffer
+	writer, err := armor.Encode(&public, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.Serialize(writer); err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &gpgKey{entity: entity, public: public.String()}
+}
+
+func (k *gpgKey) sign(t *testing.T, payload []byte) string {
+	t.Helper()
+	var signature bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&signature, k.entity, bytes.NewReader(payload), nil); err != nil {
+		t.Fatal(err)
+	}
+	return signature.String()
+}
+
+type sshKey struct {
+	signer ssh.Signer
+}
+
+func newSshKey(t *testing.T) *sshKey {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &sshKey{signer: signer}
+}
+
+func (k *sshKey) allowedSigner(principals string) string {
+	return principals + ` ` + string(ssh.MarshalAuthorizedKey(k.signer.PublicKey()))
+}
+
+// sign creates the armored signature like `ssh-keygen -Y sign -n <namespace>` does.
+func (k *sshKey) sign(t *testing.T, payload []byte, namespace string) string {
+	t.Helper()
+	hash := sha512.Sum512(payload)
+	signed := append([]byte(sshSignatureMagic), ssh.Marshal(sshSignedData{
+		Namespace:     namespace,
+		HashAlgorithm: `sha512`,
+		Hash:          hash[:],
+	})...)
+	signature, err := k.signer.Sign(rand.Reader, signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := append([]byte(sshSignatureMagic), ssh.Marshal(sshSignature{
+		Version:       1,
+		PublicKey:     k.signer.PublicKey().Marshal(),
+		Namespace:     namespace,
+		HashAlgorithm: `sha512`,
+		Signature:     ssh.Marshal(signature),
+	})...)
+	return string(pem.EncodeToMemory(&pem.Block{Type: `SSH SIGNATURE`, Bytes: blob}))
+}
+
+func testSignature() object.Signature {
+	return object.Signature{
+		Name:  `test`,
+		Email: `test@example.com`,
+		When:  time.Unix(1700000000, 0).UTC(),
+	}
+}
+
+func newCommit() *object.Commit {
+	return &object.Commit{
+		Author:    testSignature(),
+		Committer: testSignature(),
+		Message:   "release\n",
+		TreeHash:  plumbing.NewHash(`4b825dc642cb6eb9a060e54bf8d69288fbee4904`),
+	}
+}
+
+func newTag() *object.Tag {
+	return &object.Tag{
+		Name:       `v1.0.0`,
+		Tagger:     testSignature(),
+		Message:    "v1.0.0\n",
+		TargetType: plumbing.CommitObject,
+		Target:     plumbing.NewHash(`9f2a3c4b5d6e7f8091a2b3c4d5e6f708192a3b4c`),
+	}
+}
+
+func encoded(t *testing.T, encode func(*plumbing.MemoryObject) error) []byte {
+	t.Helper()
+	object := &plumbing.MemoryObject{}
+	if err := encode(object); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := object.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+func commitPayload(t *testing.T, commit *object.Commit) []byte {
+	return encoded(t, func(o *plumbing.MemoryObject) error { return commit.EncodeWithoutSignature(o) })
+}
+
+func tagPayload(t *testing.T, tag *object.Tag) []byte {
+	return encoded(t, func(o *plumbing.MemoryObject) error { return tag.EncodeWithoutSignature(o) })
+}
+
+func TestSignatureVerifier_VerifyCommit(t *testing.T) {
+	release := newGpgKey(t, `release`)
+	other := newGpgKey(t, `other`)
+	deploy := newSshKey(t)
+	stranger := newSshKey(t)
+
+	tests := []struct {
+		name     string
+		gpg      string
+		signers  string
+		sign     func(t *testing.T, payload []byte) string
+		signer   string
+		err      error
+		anyError bool
+	}{
+		{
+			name:   `gpg signed`,
+			gpg:    release.public,
+			sign:   release.sign,
+			signer: `release <release@example.com>`,
+		},
+		{
+			name:     `gpg wrong key`,
+			gpg:      release.public,
+			sign:     other.sign,
+			anyError: true,
+		},
+		{
+			name:    `gpg keys are not configured`,
+			signers: deploy.allowedSigner(`deploy@example.com`),
+			sign:    release.sign,
+			err:     ErrSignerIsNotAllowed,
+		},
+		{
+			name:    `ssh signed`,
+			signers: deploy.allowedSigner(`deploy@example.com`),
+			sign: func(t *testing.T, payload []byte) string {
+				return deploy.sign(t, payload, sshSignatureNamespace)
+			},
+			signer: `deploy@example.com ` + ssh.FingerprintSHA256(deploy.signer.PublicKey()),
+		},
+		{
+			name:    `ssh wrong key`,
+			signers: deploy.allowedSigner(`deploy@example.com`),
+			sign: func(t *testing.T, payload []byte) string {
+				return stranger.sign(t, payload, sshSignatureNamespace)
+			},
+			err: ErrSignerIsNotAllowed,
+		},
+		{
+			name:    `ssh wrong namespace`,
+			signers: deploy.allowedSigner(`deploy@example.com`),
+			sign: func(t *testing.T, payload []byte) string {
+				return deploy.sign(t, payload, `file`)
+			},
+			anyError: true,
+		},
+		{
+			name:    `ssh namespace is not allowed`,
+			signers: `deploy@example.com namespaces="file" ` + string(ssh.MarshalAuthorizedKey(deploy.signer.PublicKey())),
+			sign: func(t *testing.T, payload []byte) string {
+				return deploy.sign(t, payload, sshSignatureNamespace)
+			},
+			err: ErrSignerIsNotAllowed,
+		},
+		{
+			name:    `unsigned`,
+			gpg:     release.public,
+			signers: deploy.allowedSigner(`deploy@example.com`),
+			err:     ErrSignatureIsMissing,
+		},
+		{
+			name: `unsupported signature`,
+			gpg:  release.public,
+			sign: func(t *testing.T, payload []byte) string {
+				return "-----BEGIN SIGNED MESSAGE-----\n-----END SIGNED MESSAGE-----\n"
+			},
+			err: ErrSignatureIsUnsupported,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verifier, err := NewSignatureVerifier(test.gpg, test.signers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			commit := newCommit()
+			if test.sign != nil {
+				commit.PGPSignature = test.sign(t, commitPayload(t, commit))
+			}
+			signer, err := verifier.VerifyCommit(commit)
+			switch {
+			case test.err != nil:
+				if !errors.Is(err, test.err) {
+					t.Errorf(`error %v is expected, got %v`, test.err, err)
+				}
+			case test.anyError:
+				if err == nil {
+					t.Errorf(`error is expected, signer %q is returned`, signer)
+				}
+			case err != nil:
+				t.Errorf(`unexpected error: %v`, err)
+			case signer != test.signer:
+				t.Errorf(`signer %q is expected, got %q`, test.signer, signer)
+			}
+		})
+	}
+}
+
+func TestSignatureVerifier_VerifyTag(t *testing.T) {
+	release := newGpgKey(t, `release`)
+	deploy := newSshKey(t)
+	stranger := newSshKey(t)
+
+	verifier, err := NewSignatureVerifier(release.public, deploy.allowedSigner(`deploy@example.com`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// sign sets the signature of the tag like git does: pgp signatures are split from the message
+		// by go-git, ssh signatures stay in the message
+		sign     func(t *testing.T, tag *object.Tag)
+		err      error
+		anyError bool
+	}{
+		{
+			name: `gpg signed`,
+			sign: func(t *testing.T, tag *object.Tag) {
+				tag.PGPSignature = release.sign(t, tagPayload(t, tag))
+			},
+		},
+		{
+			name: `ssh signed`,
+			sign: func(t *testing.T, tag *object.Tag) {
+				tag.Message += deploy.sign(t, tagPayload(t, tag), sshSignatureNamespace)
+			},
+		},
+		{
+			name: `ssh wrong key`,
+			sign: func(t *testing.T, tag *object.Tag) {
+				tag.Message += stranger.sign(t, tagPayload(t, tag), sshSignatureNamespace)
+			},
+			err: ErrSignerIsNotAllowed,
+		},
+		{
+			name: `ssh signed message is changed`,
+			sign: func(t *testing.T, tag *object.Tag) {
+				signature := deploy.sign(t, tagPayload(t, tag), sshSignatureNamespace)
+				tag.Message = "v1.0.1\n" + signature
+			},
+			anyError: true,
+		},
+		{
+			name: `annotated unsigned`,
+			sign: func(t *testing.T, tag *object.Tag) {},
+			err:  ErrSignatureIsMissing,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tag := newTag()
+			test.sign(t, tag)
+			_, err := verifier.VerifyTag(tag)
+			switch {
+			case test.err != nil:
+				if !errors.Is(err, test.err) {
+					t.Errorf(`error %v is expected, got %v`, test.err, err)
+				}
+			case test.anyError:
+				if err == nil {
+					t.Error(`error is expected`)
+				}
+			case err != nil:
+				t.Errorf(`unexpected error: %v`, err)
+			}
+		})
+	}
+}
+
+func TestNewSignatureVerifier(t *testing.T) {
+	deploy := newSshKey(t)
+	publicKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(deploy.signer.PublicKey())))
+
+	tests := []struct {
+		name    string
+		gpg     string
+		signers string
+		err     bool
+	}{
+		{name: `empty`},
+		{name: `comments and blank lines`, signers: "# deploy keys\n\ndeploy@example.com " + publicKey + "\n"},
+		{name: `namespaces option`, signers: `deploy@example.com namespaces="git,file" ` + publicKey},
+		{name: `gpg is not armored`, gpg: `not a key`, err: true},
+		{name: `gpg armor is broken`, gpg: "-----BEGIN PGP PUBLIC KEY BLOCK-----\n\nbroken\n-----END PGP PUBLIC KEY BLOCK-----\n", err: true},
+		{name: `public key is missing`, signers: `deploy@example.com`, err: true},
+		{name: `public key is broken`, signers: `deploy@example.com ssh-ed25519 AAAAbroken`, err: true},
+		{name: `cert-authority is not supported`, signers: `*@example.com cert-authority ` + publicKey, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewSignatureVerifier(test.gpg, test.signers)
+			if test.err && err == nil {
+				t.Error(`error is expected`)
+			}
+			if !test.err && err != nil {
+				t.Errorf(`unexpected error: %v`, err)
+			}
+		})
+	}
+}
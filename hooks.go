@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"os/exec"
+	"sort"
+	"time"
+)
+
+const postSyncHook = `postSync`
+
+// hookChange describes the change of HEAD that triggered the hook.
+type hookChange struct {
+	oldSha string
+	newSha string
+	ref    string
+}
+
+// runHook runs the command of the hook, stdout and stderr are written to the log.
+// Env variables of the app, GIT_SYNC_* variables of the change and env of the hook are passed to the command.
+func runHook(name string, hook *Hook, tc *TaskConfig, change hookChange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hook.Timeout())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, hook.Command, hook.Args...)
+	cmd.Dir = hookWorkDir(hook, tc)
+	cmd.Env = append(os.Environ(),
+		`GIT_SYNC_TASK=`+tc.Name,
+		`GIT_SYNC_PATH=`+tc.Path,
+		`GIT_SYNC_REF=`+change.ref,
+		`GIT_SYNC_OLD_SHA=`+change.oldSha,
+		`GIT_SYNC_NEW_SHA=`+change.newSha,
+	)
+	keys := make([]string, 0, len(hook.Env))
+	for key := range hook.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		cmd.Env = append(cmd.Env, key+`=`+hook.Env[key])
+	}
+
+	fields := log.Fields{
+		`name`:    tc.Name,
+		`hook`:    name,
+		`old_sha`: change.oldSha,
+		`new_sha`: change.newSha,
+	}
+	cmd.Stdout = NewLogrusWriter(log.InfoLevel).WithFields(fields)
+	cmd.Stderr = NewLogrusWriter(log.WarnLevel).WithFields(fields)
+
+	log.WithFields(fields).WithFields(log.Fields{
+		`command`: hook.Command,
+		`dir`:     cmd.Dir,
+	}).Debug(`run hook`)
+
+	start := time.Now()
+	err := cmd.Run()
+	hookDurationSeconds.WithLabelValues(tc.Name, name).Observe(time.Since(start).Seconds())
+	hookRunsTotal.WithLabelValues(tc.Name, name).Inc()
+
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf(`hook %s has timed out after %s`, name, hook.Timeout())
+	} else if err != nil {
+		err = fmt.Errorf(`hook %s has failed: %v`, name, err)
+	}
+	if err != nil {
+		hookFailuresTotal.WithLabelValues(tc.Name, name).Inc()
+		log.WithError(err).WithFields(fields).Error(`hook has failed`)
+		return err
+	}
+
+	log.WithFields(fields).WithFields(log.Fields{
+		`duration`: time.Since(start),
+	}).Info(`hook has been finished`)
+	return nil
+}
+
+func hookWorkDir(hook *Hook, tc *TaskConfig) string {
+	if len(hook.WorkDir) > 0 {
+		return hook.WorkDir
+	}
+	if tc.Publish != nil {
+		return tc.Publish.Link
+	}
+	return tc.Path
+}
@@ -79,19 +79,15 @@ func (l *logrusWriter) WithFields(fields log.Fields) LogrusWriter {
 	return l
 }
 
+// Write logs the text as one entry, the whole input is always consumed,
+// otherwise writers like exec.Cmd pipes fail with a short write.
 func (l *logrusWriter) Write(p []byte) (int, error) {
 	logger := l.logger
 	if logger.IsLevelEnabled(l.level) {
-		fields := l.fields
-		text := string(p)
-		if text[0] == 10 || text[0] == 13 {
-			text = text[1:]
+		text := strings.Trim(string(p), "\r\n")
+		if len(text) > 0 {
+			logger.WithFields(l.fields).Log(l.level, text)
 		}
-		if text[len(text)-1] == 10 || text[len(text)-1] == 13 {
-			text = text[:len(text)-1]
-		}
-		logger.WithFields(fields).Log(l.level, text)
-		return len(p), nil
 	}
-	return 0, nil
+	return len(p), nil
 }
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 	"gopkg.in/yaml.v2"
+	"net/http"
 	"os"
+	"os/signal"
 	. "registry.fozzy.lan/palefat/git-sync-go/errors"
+	. "registry.fozzy.lan/palefat/git-sync-go/git"
 	. "registry.fozzy.lan/palefat/git-sync-go/scheduler"
+	"syscall"
+	"time"
 )
 
 var (
@@ -36,6 +43,10 @@ func main() {
 			&configFileFlag,
 			&startServerFlag,
 			&serverPortFlag,
+			&shutdownTimeoutFlag,
+			&stallTimeoutFlag,
+			&configReloadIntervalFlag,
+			&cleanupRemovedFlag,
 		},
 		Before: func(c *cli.Context) error {
 			return configureLogs(LogConfig{
@@ -45,6 +56,9 @@ func main() {
 				colors: c.Bool(logColorsFlag.Name),
 			})
 		},
+		Commands: []*cli.Command{
+			validateCommand,
+		},
 		Action: cliAction,
 	}
 
@@ -56,34 +70,141 @@ func main() {
 
 func cliAction(c *cli.Context) error {
 
-	appErrChan = make(chan error)
+	appErrChan = make(chan error, 1)
 	scheduler = NewAppScheduler(appErrChan)
 
+	InstallByteCounter()
+
+	var server *http.Server
+
 	defer func() {
-		_ = scheduler.Close()
-		log.Debug(`task scheduler has been closed`)
+		shutdown(c.Duration(shutdownTimeoutFlag.Name), server)
 	}()
 
+	if len(c.String(configFileFlag.Name)) == 0 {
+		return fmt.Errorf(`flag "%s" is required`, configFileFlag.Name)
+	}
+
 	serverPort := c.Int(serverPortFlag.Name)
 	if serverPort < 1 {
 		return fmt.Errorf(`web server port cannot be less than 1`)
 	}
 
-	if err := scheduleTasks(c); err != nil {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	go func() {
+		sig := <-signals
+		log.WithFields(log.Fields{
+			`signal`: sig,
+		}).Info(`shutdown signal has been received`)
+		select {
+		case appErrChan <- ErrAppIsDone:
+		default:
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(c.Context)
+	defer cancel()
+
+	if err := scheduleTasks(ctx, c); err != nil {
 		return err
 	}
 
 	if c.Bool(startServerFlag.Name) {
-		scheduler.Execute(func() error {
-			return startServer(serverPort)
-		})
+		server = newServer(serverPort, c.Duration(stallTimeoutFlag.Name))
+		go func() {
+			if err := startServer(server); err != nil {
+				select {
+				case appErrChan <- err:
+				default:
+				}
+			}
+		}()
 	}
 
 	return scheduler.WaitError()
 }
-func scheduleTasks(c *cli.Context) error {
+
+// shutdown stops scheduling new runs, waits for in-flight runs and notifications and stops the http server.
+func shutdown(timeout time.Duration, server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := scheduler.Shutdown(ctx); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			`timeout`: timeout,
+		}).Warn(`in-flight tasks have not been finished in time`)
+	} else {
+		log.Debug(`task scheduler has been closed`)
+	}
+
+	if err := appNotifier.Wait(ctx); err != nil {
+		log.WithError(err).Warn(`pending notifications have not been sent in time`)
+	}
+
+	if server != nil {
+		if err := server.Shutdown(ctx); err != nil {
+			log.WithError(err).Warn(`unable to shutdown http server gracefully`)
+		} else {
+			log.Debug(`http server has been closed`)
+		}
+	}
+}
+
+func scheduleTasks(ctx context.Context, c *cli.Context) error {
 
 	path := c.String(configFileFlag.Name)
+	config, checksum, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+
+	appWebhooks.Store(config.Webhooks)
+	appNotifier.SetGlobal(config.Notify)
+
+	runOnceCount := 0
+	for _, taskConfig := range config.Tasks {
+		if taskConfig.RunOnce {
+			runOnceCount++
+		}
+	}
+
+	// the app exits when all tasks are run-once and all of them are finished
+	runOnce := &runOnceGroup{
+		exit: runOnceCount > 0 && runOnceCount == len(config.Tasks),
+	}
+
+	for _, taskConfig := range config.Tasks {
+		if err = scheduleTask(taskConfig, runOnce); err != nil {
+			return err
+		}
+	}
+
+	if runOnce.exit {
+		go func() {
+			appErrChan <- runOnce.Wait()
+		}()
+		return nil
+	}
+
+	reloader := &configReloader{
+		path:     path,
+		cleanup:  c.Bool(cleanupRemovedFlag.Name),
+		config:   config,
+		checksum: checksum,
+		runOnce:  runOnce,
+	}
+	go reloader.watch(ctx, c.Duration(configReloadIntervalFlag.Name))
+
+	return nil
+}
+
+// loadConfig reads and validates the config file, the checksum of the content is returned to detect changes.
+func loadConfig(path string) (*Config, [sha256.Size]byte, error) {
+	var checksum [sha256.Size]byte
+
 	stat, err := os.Stat(path)
 	if err != nil || stat.IsDir() {
 
@@ -91,60 +212,69 @@ func scheduleTasks(c *cli.Context) error {
 			`path`: path,
 		}).Error(`config file is not found`)
 
-		return err
+		if err == nil {
+			err = fmt.Errorf(`config file %s is a directory`, path)
+		}
+		return nil, checksum, err
 	}
 
-	file, err := os.Open(path)
+	content, err := os.ReadFile(path)
 	if err != nil {
 
 		log.WithError(err).WithFields(log.Fields{
 			`path`: path,
 		}).Error(`unable to open config file`)
 
-		return err
+		return nil, checksum, err
 	}
-
-	defer func() {
-		_ = file.Close()
-		if log.IsLevelEnabled(log.TraceLevel) {
-			log.WithFields(log.Fields{
-				`path`: path,
-			}).Tracef(`file has been closed`)
-		}
-	}()
+	checksum = sha256.Sum256(content)
 
 	config := &Config{}
-	err = yaml.NewDecoder(file).Decode(config)
+	err = yaml.Unmarshal(content, config)
 	if err != nil {
-		return err
+		return nil, checksum, err
 	}
 
 	err = config.Validate()
 	if err != nil {
-		return err
+		return nil, checksum, err
 	}
 
-	for _, taskConfig := range config.Tasks {
-		scheduleTask(taskConfig)
+	return config, checksum, nil
+}
+
+func scheduleTask(tc *TaskConfig, runOnce *runOnceGroup) error {
+	runner, err := newTaskRunner(tc)
+	if err != nil {
+		return err
 	}
+	appTasks.add(runner)
 
-	return nil
-}
+	if tc.RunOnce {
+		runOnce.add()
+	}
+	return scheduler.Execute(func() error {
+		if tc.RunOnce {
+			return runOnce.done(tc, runner.RunOnce())
+		}
 
-func scheduleTask(tc *TaskConfig) {
-	scheduler.Execute(func() error {
-		task, err := NewGitSyncTask(tc)
+		next, err := runner.Run()
 		if err != nil {
 			return err
 		}
-		if err = task.CloneOrAttach(); err != nil {
-			return err
-		}
-		if tc.RunOnce {
-			log.Warn(`run-once mode is not fully supported yet. application will not stop if all task are run-once mode`)
+		var job Job
+		if len(tc.Schedule) > 0 {
+			job, err = scheduler.ScheduleWithCron(func() error {
+				_, err := runner.Run()
+				return err
+			}, tc.Schedule)
 		} else {
-			scheduler.Schedule(task.Pull, tc.Interval())
+			job, err = scheduler.ScheduleWithNextDelay(runner.Run, next)
+		}
+		if err != nil {
+			return err
 		}
+		runner.setJob(job)
 		return nil
 	})
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = `git_sync`
+
+var (
+	syncAttemptsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      `attempts_total`,
+		Help:      `Number of sync attempts`,
+	}, []string{`task`})
+
+	syncSuccessesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      `successes_total`,
+		Help:      `Number of successful syncs`,
+	}, []string{`task`})
+
+	syncFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      `failures_total`,
+		Help:      `Number of failed syncs`,
+	}, []string{`task`})
+
+	cloneDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      `clone_duration_seconds`,
+		Help:      `Duration of clone (or attach) of the repo`,
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 14),
+	}, []string{`task`})
+
+	pullDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      `pull_duration_seconds`,
+		Help:      `Duration of pull of the repo`,
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 14),
+	}, []string{`task`})
+
+	lastSuccessTimestampSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      `last_success_timestamp_seconds`,
+		Help:      `Unix time of the last successful sync`,
+	}, []string{`task`})
+
+	commitInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      `commit_info`,
+		Help:      `Current HEAD of the repo, the value is always 1`,
+	}, []string{`task`, `sha`, `ref`})
+
+	fetchedBytesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      `fetched_bytes_total`,
+		Help:      `Bytes received from http(s) remotes, including ref listings (insecure and ssh remotes are not counted)`,
+	}, []string{`task`})
+
+	manualCloneFallbacksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      `manual_clone_fallbacks_total`,
+		Help:      `Number of fallbacks to the manual git clone`,
+	}, []string{`task`})
+
+	hookRunsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      `hook_runs_total`,
+		Help:      `Number of hook runs`,
+	}, []string{`task`, `hook`})
+
+	hookFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      `hook_failures_total`,
+		Help:      `Number of failed hook runs (including timeouts)`,
+	}, []string{`task`, `hook`})
+
+	hookDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      `hook_duration_seconds`,
+		Help:      `Duration of hook runs`,
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 14),
+	}, []string{`task`, `hook`})
+
+	notificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      `notifications_total`,
+		Help:      `Number of event notifications by the result (sent, failed)`,
+	}, []string{`task`, `event`, `result`})
+)
+
+// forgetTaskMetrics deletes series of the removed task, commit_info is deleted when the runner is stopped.
+func forgetTaskMetrics(name string) {
+	for _, vec := range []*prometheus.MetricVec{
+		syncAttemptsTotal.MetricVec,
+		syncSuccessesTotal.MetricVec,
+		syncFailuresTotal.MetricVec,
+		cloneDurationSeconds.MetricVec,
+		pullDurationSeconds.MetricVec,
+		lastSuccessTimestampSeconds.MetricVec,
+		fetchedBytesTotal.MetricVec,
+		manualCloneFallbacksTotal.MetricVec,
+	} {
+		vec.DeleteLabelValues(name)
+	}
+	for _, vec := range []*prometheus.MetricVec{
+		hookRunsTotal.MetricVec,
+		hookFailuresTotal.MetricVec,
+		hookDurationSeconds.MetricVec,
+	} {
+		vec.DeleteLabelValues(name, postSyncHook)
+	}
+	for _, event := range []string{NotifyEventSynced, NotifyEventFailed, NotifyEventRecovered} {
+		for _, result := range []string{`sent`, `failed`} {
+			notificationsTotal.DeleteLabelValues(name, event, result)
+		}
+	}
+}
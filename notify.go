@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	notifySignatureHeader = `X-Git-Sync-Signature-256`
+	notifyEventHeader     = `X-Git-Sync-Event`
+	notifyDeliveryHeader  = `X-Git-Sync-Delivery`
+
+	// maxNotifyCommits limits the number of commits in the synced event
+	maxNotifyCommits = 20
+)
+
+// notifyPayload is the JSON body of the event.
+type notifyPayload struct {
+	Event    string         `json:"event"`
+	Task     string         `json:"task"`
+	Url      string         `json:"url"`
+	Path     string         `json:"path"`
+	Ref      string         `json:"ref,omitempty"`
+	OldSha   string         `json:"oldSha,omitempty"`
+	NewSha   string         `json:"newSha,omitempty"`
+	Commits  []notifyCommit `json:"commits,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Failures int            `json:"failures,omitempty"`
+	Time     time.Time      `json:"time"`
+}
+
+type notifyCommit struct {
+	Sha     string    `json:"sha"`
+	Message string    `json:"message"`
+	Author  string    `json:"author"`
+	Time    time.Time `json:"time"`
+}
+
+// notifier delivers events in background, Wait blocks until all deliveries are finished.
+type notifier struct {
+	client *http.Client
+	// retryDelay is the delay before the first retry, it is doubled for each next one
+	retryDelay time.Duration
+	wg         sync.WaitGroup
+	// global receives events of all tasks, it is replaced when the config file is reloaded
+	global atomic.Pointer[[]*Notify]
+}
+
+var appNotifier = &notifier{
+	client:     &http.Client{},
+	retryDelay: time.Second,
+}
+
+// SetGlobal replaces receivers of events of all tasks.
+func (n *notifier) SetGlobal(receivers []*Notify) {
+	n.global.Store(&receivers)
+}
+
+// Receivers returns global receivers followed by receivers of the task.
+func (n *notifier) Receivers(task []*Notify) []*Notify {
+	var receivers []*Notify
+	if global := n.global.Load(); global != nil {
+		receivers = append(receivers, *global...)
+	}
+	return append(receivers, task...)
+}
+
+// Send posts the payload to all receivers that accept the event.
+func (n *notifier) Send(receivers []*Notify, payload *notifyPayload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			`name`:  payload.Task,
+			`event`: payload.Event,
+		}).Error(`unable to encode notification`)
+		return
+	}
+	for _, receiver := range receivers {
+		if !receiver.Accepts(payload.Event) {
+			continue
+		}
+		n.wg.Add(1)
+		go func(receiver *Notify) {
+			defer n.wg.Done()
+			n.deliver(receiver, payload, body)
+		}(receiver)
+	}
+}
+
+// Wait blocks until pending deliveries are finished or the context is done.
+func (n *notifier) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (n *notifier) deliver(receiver *Notify, payload *notifyPayload, body []byte) {
+	logger := log.WithFields(log.Fields{
+		`name`:     payload.Task,
+		`event`:    payload.Event,
+		`receiver`: receiver.RedactedUrl(),
+	})
+
+	delivery := newDeliveryId()
+	delay := n.retryDelay
+	var err error
+	for attempt := 0; attempt <= *receiver.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		var retry bool
+		retry, err = n.post(receiver, payload.Event, delivery, body)
+		if err == nil {
+			notificationsTotal.WithLabelValues(payload.Task, payload.Event, `sent`).Inc()
+			logger.Debug(`notification has been sent`)
+			return
+		}
+		if !retry {
+			break
+		}
+		logger.WithError(err).WithFields(log.Fields{
+			`attempt`: attempt + 1,
+		}).Debug(`unable to send notification`)
+	}
+
+	notificationsTotal.WithLabelValues(payload.Task, payload.Event, `failed`).Inc()
+	logger.WithError(err).Error(`unable to send notification`)
+}
+
+// post sends the request once, the bool result tells if the delivery can be retried.
+func (n *notifier) post(receiver *Notify, event string, delivery string, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), receiver.Timeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, receiver.Url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set(`Content-Type`, `application/json`)
+	req.Header.Set(`User-Agent`, `git-sync/`+AppVersion)
+	req.Header.Set(notifyEventHeader, event)
+	req.Header.Set(notifyDeliveryHeader, delivery)
+	for name, secret := range receiver.Headers {
+		value, err := secret.GetValue()
+		if err != nil {
+			return false, fmt.Errorf(`header %s -> %v`, name, err)
+		}
+		req.Header.Set(name, strings.TrimRight(value, "\r\n"))
+	}
+	if receiver.Secret != nil {
+		secret, err := receiver.Secret.GetValue()
+		if err != nil {
+			return false, fmt.Errorf(`secret -> %v`, err)
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set(notifySignatureHeader, `sha256=`+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf(`unexpected response status %s`, resp.Status)
+}
+
+func newDeliveryId() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// notifyReceiver records requests and answers them with the statuses one by one, the last status is repeated.
+type notifyReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *notifyReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := r.statuses[len(r.statuses)-1]
+	if len(r.requests) < len(r.statuses) {
+		status = r.statuses[len(r.requests)]
+	}
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(status)
+}
+
+func newTestNotifier() *notifier {
+	return &notifier{
+		client:     &http.Client{},
+		retryDelay: time.Millisecond,
+	}
+}
+
+func newTestNotify(t *testing.T, url string, retries int) *Notify {
+	t.Helper()
+	notify := &Notify{Url: url, Retries: &retries}
+	if err := notify.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return notify
+}
+
+func waitNotifier(t *testing.T, n *notifier) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := n.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotifier_SendRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  int
+		attempts int
+	}{
+		{name: `sent`, statuses: []int{http.StatusOK}, retries: 3, attempts: 1},
+		{name: `accepted`, statuses: []int{http.StatusAccepted}, retries: 3, attempts: 1},
+		{name: `5xx is retried`, statuses: []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK}, retries: 3, attempts: 3},
+		{name: `429 is retried`, statuses: []int{http.StatusTooManyRequests, http.StatusNoContent}, retries: 3, attempts: 2},
+		{name: `retries are limited`, statuses: []int{http.StatusServiceUnavailable}, retries: 2, attempts: 3},
+		{name: `no retries`, statuses: []int{http.StatusServiceUnavailable}, retries: 0, attempts: 1},
+		{name: `400 is not retried`, statuses: []int{http.StatusBadRequest}, retries: 3, attempts: 1},
+		{name: `401 is not retried`, statuses: []int{http.StatusUnauthorized}, retries: 3, attempts: 1},
+		{name: `404 is not retried`, statuses: []int{http.StatusNotFound}, retries: 3, attempts: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			receiver := &notifyReceiver{statuses: test.statuses}
+			server := httptest.NewServer(receiver)
+			defer server.Close()
+
+			n := newTestNotifier()
+			n.Send([]*Notify{newTestNotify(t, server.URL, test.retries)}, &notifyPayload{
+				Event: NotifyEventFailed,
+				Task:  `a`,
+			})
+			waitNotifier(t, n)
+
+			receiver.mu.Lock()
+			defer receiver.mu.Unlock()
+			if len(receiver.requests) != test.attempts {
+				t.Fatalf(`%d attempts are expected, got %d`, test.attempts, len(receiver.requests))
+			}
+			delivery := receiver.requests[0].Header.Get(notifyDeliveryHeader)
+			if len(delivery) == 0 {
+				t.Error(`delivery header is missing`)
+			}
+			for _, req := range receiver.requests {
+				if req.Header.Get(notifyDeliveryHeader) != delivery {
+					t.Errorf(`retries have to keep the delivery %s, got %s`, delivery, req.Header.Get(notifyDeliveryHeader))
+				}
+			}
+		})
+	}
+}
+
+func TestNotifier_SendHeaders(t *testing.T) {
+	t.Setenv(`GIT_SYNC_TEST_NOTIFY_TOKEN`, "Bearer from-env\n")
+
+	receiver := &notifyReceiver{statuses: []int{http.StatusOK}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	notify := newTestNotify(t, server.URL, 0)
+	notify.Headers = map[string]*Secret{
+		`Authorization`: {ValueFrom: &SecretValueFrom{Env: `GIT_SYNC_TEST_NOTIFY_TOKEN`}},
+		`X-Team`:        {Value: `infra`},
+	}
+	notify.Secret = &Secret{Value: `hmac-secret`}
+
+	n := newTestNotifier()
+	n.Send([]*Notify{notify}, &notifyPayload{
+		Event:  NotifyEventSynced,
+		Task:   `a`,
+		OldSha: `1111111111111111111111111111111111111111`,
+		NewSha: `2222222222222222222222222222222222222222`,
+	})
+	waitNotifier(t, n)
+
+	if len(receiver.requests) != 1 {
+		t.Fatalf(`1 request is expected, got %d`, len(receiver.requests))
+	}
+	req, body := receiver.requests[0], receiver.bodies[0]
+
+	mac := hmac.New(sha256.New, []byte(`hmac-secret`))
+	mac.Write(body)
+	for header, expected := range map[string]string{
+		notifySignatureHeader: `sha256=` + hex.EncodeToString(mac.Sum(nil)),
+		notifyEventHeader:     NotifyEventSynced,
+		`Content-Type`:        `application/json`,
+		`Authorization`:       `Bearer from-env`,
+		`X-Team`:              `infra`,
+	} {
+		if value := req.Header.Get(header); value != expected {
+			t.Errorf(`header %s: %q is expected, got %q`, header, expected, value)
+		}
+	}
+
+	payload := &notifyPayload{}
+	if err := json.Unmarshal(body, payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != NotifyEventSynced || payload.NewSha != `2222222222222222222222222222222222222222` {
+		t.Errorf(`unexpected payload %+v`, payload)
+	}
+}
+
+func TestNotifier_SendWithoutSecret(t *testing.T) {
+	receiver := &notifyReceiver{statuses: []int{http.StatusOK}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	n := newTestNotifier()
+	n.Send([]*Notify{newTestNotify(t, server.URL, 0)}, &notifyPayload{Event: NotifyEventRecovered})
+	waitNotifier(t, n)
+
+	if len(receiver.requests) != 1 {
+		t.Fatalf(`1 request is expected, got %d`, len(receiver.requests))
+	}
+	if signature := receiver.requests[0].Header.Get(notifySignatureHeader); len(signature) > 0 {
+		t.Errorf(`signature is not expected without the secret, got %s`, signature)
+	}
+}
+
+func TestNotifier_SendFiltersEvents(t *testing.T) {
+	all := &notifyReceiver{statuses: []int{http.StatusOK}}
+	allServer := httptest.NewServer(all)
+	defer allServer.Close()
+	failures := &notifyReceiver{statuses: []int{http.StatusOK}}
+	failuresServer := httptest.NewServer(failures)
+	defer failuresServer.Close()
+
+	failuresNotify := newTestNotify(t, failuresServer.URL, 0)
+	failuresNotify.Events = []string{NotifyEventFailed, NotifyEventRecovered}
+	receivers := []*Notify{newTestNotify(t, allServer.URL, 0), failuresNotify}
+
+	n := newTestNotifier()
+	for _, event := range []string{NotifyEventSynced, NotifyEventFailed, NotifyEventSynced} {
+		n.Send(receivers, &notifyPayload{Event: event})
+	}
+	waitNotifier(t, n)
+
+	if len(all.requests) != 3 {
+		t.Errorf(`3 events are expected by the receiver of all events, got %d`, len(all.requests))
+	}
+	if len(failures.requests) != 1 || failures.requests[0].Header.Get(notifyEventHeader) != NotifyEventFailed {
+		t.Errorf(`only the failed event is expected, got %d events`, len(failures.requests))
+	}
+}
+
+func TestNotify_Accepts(t *testing.T) {
+	tests := []struct {
+		name     string
+		events   []string
+		event    string
+		accepted bool
+	}{
+		{name: `all events by default`, event: NotifyEventSynced, accepted: true},
+		{name: `listed event`, events: []string{NotifyEventFailed, NotifyEventRecovered}, event: NotifyEventRecovered, accepted: true},
+		{name: `not listed event`, events: []string{NotifyEventFailed}, event: NotifyEventSynced},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			notify := &Notify{Events: test.events}
+			if accepted := notify.Accepts(test.event); accepted != test.accepted {
+				t.Errorf(`Accepts(%s) = %v, want %v`, test.event, accepted, test.accepted)
+			}
+		})
+	}
+}
+
+func TestNotifier_Receivers(t *testing.T) {
+	n := newTestNotifier()
+	task := []*Notify{{Url: `https://example.com/task`}}
+	if receivers := n.Receivers(task); len(receivers) != 1 {
+		t.Errorf(`only task receivers are expected without global ones, got %d`, len(receivers))
+	}
+
+	global := []*Notify{{Url: `https://example.com/global`}}
+	n.SetGlobal(global)
+	receivers := n.Receivers(task)
+	if len(receivers) != 2 || receivers[0] != global[0] || receivers[1] != task[0] {
+		t.Errorf(`global receivers followed by task receivers are expected, got %v`, receivers)
+	}
+}
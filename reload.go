@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// configReloader applies changes of the config file to the scheduled tasks.
+// Added tasks are scheduled, removed tasks are stopped and changed tasks are rescheduled,
+// unchanged tasks are not touched. An invalid config is rejected and the current one is kept.
+type configReloader struct {
+	path     string
+	cleanup  bool
+	mu       sync.Mutex
+	config   *Config
+	checksum [sha256.Size]byte
+	runOnce  *runOnceGroup
+}
+
+// watch reloads the config on SIGHUP and when the content of the file is changed.
+func (r *configReloader) watch(ctx context.Context, interval time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	var ticks <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			log.WithFields(log.Fields{
+				`signal`: sig,
+				`path`:   r.path,
+			}).Info(`reload signal has been received`)
+			r.reload(true)
+		case <-ticks:
+			r.reload(false)
+		}
+	}
+}
+
+// reload applies the config file, if force is not set the file is applied only if its content is changed.
+func (r *configReloader) reload(force bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	content, err := os.ReadFile(r.path)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			`path`: r.path,
+		}).Error(`unable to read config file, keep the current config`)
+		return
+	}
+	if !force && sha256.Sum256(content) == r.checksum {
+		return
+	}
+
+	config, checksum, err := loadConfig(r.path)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			`path`: r.path,
+		}).Error(`config has been rejected, keep the current config`)
+		if checksum != [sha256.Size]byte{} {
+			// the same broken content is not reported again until it is changed
+			r.checksum = checksum
+		}
+		return
+	}
+
+	current := make(map[string]*TaskConfig, len(r.config.Tasks))
+	for _, tc := range r.config.Tasks {
+		current[tc.Name] = tc
+	}
+	paths := make(map[string]bool, len(config.Tasks))
+	for _, tc := range config.Tasks {
+		for _, path := range tc.ownedPaths() {
+			paths[filepath.Clean(path)] = true
+		}
+	}
+
+	var added, changed, removed []*TaskConfig
+	for _, tc := range config.Tasks {
+		old, found := current[tc.Name]
+		if !found {
+			added = append(added, tc)
+			continue
+		}
+		delete(current, tc.Name)
+		if !reflect.DeepEqual(old, tc) {
+			changed = append(changed, tc)
+		}
+	}
+	for _, tc := range r.config.Tasks {
+		if _, found := current[tc.Name]; found {
+			removed = append(removed, tc)
+		}
+	}
+
+	// global receivers are not a part of task configs, running tasks pick them up without a restart
+	appNotifier.SetGlobal(config.Notify)
+
+	// tasks are stopped first, so their paths can be reused by new tasks
+	for _, tc := range removed {
+		r.stopTask(tc, paths)
+		appTasks.remove(tc.Name)
+		forgetTaskMetrics(tc.Name)
+		log.WithFields(log.Fields{
+			`name`: tc.Name,
+			`url`:  tc.RedactedUrl(),
+			`path`: tc.Path,
+		}).Info(`task has been removed`)
+	}
+	for _, tc := range changed {
+		r.stopTask(tc, paths)
+		r.scheduleTask(tc, `task has been changed`)
+	}
+	for _, tc := range added {
+		r.scheduleTask(tc, `task has been added`)
+	}
+
+	appWebhooks.Store(config.Webhooks)
+	r.config = config
+	r.checksum = checksum
+
+	log.WithFields(log.Fields{
+		`path`:    r.path,
+		`added`:   len(added),
+		`changed`: len(changed),
+		`removed`: len(removed),
+	}).Info(`config has been reloaded`)
+}
+
+// stopTask stops the runner of the task and deletes its directories if cleanup is enabled
+// and the directories are not used by the new config.
+func (r *configReloader) stopTask(tc *TaskConfig, paths map[string]bool) {
+	runner, found := appTasks.get(tc.Name)
+	if !found {
+		return
+	}
+	runner.stop()
+
+	if !r.cleanup {
+		return
+	}
+	for _, path := range runner.config.ownedPaths() {
+		if paths[filepath.Clean(path)] {
+			continue
+		}
+		logger := log.WithFields(log.Fields{
+			`name`: tc.Name,
+			`path`: path,
+		})
+		if err := os.RemoveAll(path); err != nil {
+			logger.WithError(err).Error(`unable to delete directory of the task`)
+			continue
+		}
+		logger.Info(`directory of the task has been deleted`)
+	}
+}
+
+func (r *configReloader) scheduleTask(tc *TaskConfig, message string) {
+	logger := log.WithFields(log.Fields{
+		`name`: tc.Name,
+		`url`:  tc.RedactedUrl(),
+		`path`: tc.Path,
+	})
+	if err := scheduleTask(tc, r.runOnce); err != nil {
+		logger.WithError(err).Error(`unable to schedule task`)
+		return
+	}
+	logger.Info(message)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	. "registry.fozzy.lan/palefat/git-sync-go/errors"
+	"strings"
+	"sync"
+)
+
+// runOnceGroup tracks run-once tasks.
+// If exit is set, task errors are collected instead of stopping the app and Wait reports the result,
+// otherwise an error stops the app only if the task is configured with onError: exit.
+type runOnceGroup struct {
+	exit   bool
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	failed []string
+}
+
+func (g *runOnceGroup) add() {
+	g.wg.Add(1)
+}
+
+func (g *runOnceGroup) done(tc *TaskConfig, err error) error {
+	defer g.wg.Done()
+
+	if err == nil {
+		log.WithFields(log.Fields{
+			`name`: tc.Name,
+			`url`:  tc.Url,
+			`path`: tc.Path,
+		}).Info(`run-once task is finished`)
+		return nil
+	}
+
+	if err == ErrTaskIsStopped {
+		log.WithFields(log.Fields{
+			`name`: tc.Name,
+			`url`:  tc.Url,
+			`path`: tc.Path,
+		}).Info(`run-once task is removed before the run`)
+		return nil
+	}
+
+	if !g.exit && tc.OnError == OnErrorExit {
+		return err
+	}
+
+	log.WithError(err).WithFields(log.Fields{
+		`name`: tc.Name,
+		`url`:  tc.Url,
+		`path`: tc.Path,
+	}).Error(`run-once task is failed`)
+
+	if g.exit {
+		g.mu.Lock()
+		g.failed = append(g.failed, tc.Name)
+		g.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Wait blocks until all run-once tasks are finished.
+// It returns ErrAppIsDone if all of them are finished successfully.
+func (g *runOnceGroup) Wait() error {
+	g.wg.Wait()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.failed) > 0 {
+		return fmt.Errorf(`run-once tasks are failed: %s`, strings.Join(g.failed, `, `))
+	}
+
+	log.Info(`all run-once tasks are finished`)
+
+	return ErrAppIsDone
+}
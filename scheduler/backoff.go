@@ -0,0 +1,60 @@
+package scheduler
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	jitterRand   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	jitterRandMu sync.Mutex
+)
+
+// Backoff calculates exponentially growing delays between retries of a failing job.
+type Backoff struct {
+	InitialDelay time.Duration
+	Multiplier   float64
+	// MaxDelay is the upper bound of delays (including the jitter), delays are not limited if it is 0
+	MaxDelay time.Duration
+	// Jitter is a fraction (0..1) of the delay that is randomly added or subtracted,
+	// so replicas do not retry at the same moment.
+	Jitter float64
+}
+
+// Delay returns the delay after the given number of consecutive failures (starting from 1).
+func (b *Backoff) Delay(failures int) time.Duration {
+	if failures < 1 {
+		failures = 1
+	}
+
+	// the power overflows to +Inf at high failure counts
+	delay := float64(b.InitialDelay) * math.Pow(b.Multiplier, float64(failures-1))
+	if math.IsNaN(delay) {
+		delay = 0
+	}
+	delay = b.limit(delay)
+
+	if b.Jitter > 0 {
+		jitterRandMu.Lock()
+		factor := 1 + b.Jitter*(2*jitterRand.Float64()-1)
+		jitterRandMu.Unlock()
+		delay = b.limit(delay * factor)
+	}
+
+	return time.Duration(delay)
+}
+
+// maxDuration is the largest float64 that fits into time.Duration, float64(math.MaxInt64) is 2^63 and overflows it.
+var maxDuration = math.Nextafter(float64(math.MaxInt64), 0)
+
+func (b *Backoff) limit(delay float64) float64 {
+	if b.MaxDelay > 0 && delay > float64(b.MaxDelay) {
+		return float64(b.MaxDelay)
+	}
+	if delay > maxDuration {
+		return maxDuration
+	}
+	return delay
+}
@@ -0,0 +1,133 @@
+package scheduler
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBackoff_Delay(t *testing.T) {
+	tests := []struct {
+		name     string
+		backoff  Backoff
+		failures int
+		want     time.Duration
+	}{
+		{
+			name:     `first failure`,
+			backoff:  Backoff{InitialDelay: 10 * time.Second, Multiplier: 2, MaxDelay: time.Hour},
+			failures: 1,
+			want:     10 * time.Second,
+		},
+		{
+			name:     `failures below 1`,
+			backoff:  Backoff{InitialDelay: 10 * time.Second, Multiplier: 2, MaxDelay: time.Hour},
+			failures: 0,
+			want:     10 * time.Second,
+		},
+		{
+			name:     `exponential growth`,
+			backoff:  Backoff{InitialDelay: 10 * time.Second, Multiplier: 2, MaxDelay: time.Hour},
+			failures: 4,
+			want:     80 * time.Second,
+		},
+		{
+			name:     `fractional multiplier`,
+			backoff:  Backoff{InitialDelay: 10 * time.Second, Multiplier: 1.5, MaxDelay: time.Hour},
+			failures: 3,
+			want:     22500 * time.Millisecond,
+		},
+		{
+			name:     `constant delay`,
+			backoff:  Backoff{InitialDelay: 10 * time.Second, Multiplier: 1, MaxDelay: time.Hour},
+			failures: 100,
+			want:     10 * time.Second,
+		},
+		{
+			name:     `cap`,
+			backoff:  Backoff{InitialDelay: 10 * time.Second, Multiplier: 2, MaxDelay: time.Minute},
+			failures: 4,
+			want:     time.Minute,
+		},
+		{
+			name:     `overflow is capped`,
+			backoff:  Backoff{InitialDelay: 10 * time.Second, Multiplier: 2, MaxDelay: time.Hour},
+			failures: 5000,
+			want:     time.Hour,
+		},
+		{
+			name:     `overflow without cap`,
+			backoff:  Backoff{InitialDelay: 10 * time.Second, Multiplier: 2},
+			failures: 5000,
+			want:     time.Duration(math.MaxInt64 - 1023),
+		},
+		{
+			name:     `overflow of zero initial delay`,
+			backoff:  Backoff{Multiplier: 2},
+			failures: 5000,
+			want:     0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.backoff.Delay(test.failures); got != test.want {
+				t.Errorf(`Delay(%d) = %v, want %v`, test.failures, got, test.want)
+			}
+		})
+	}
+}
+
+func TestBackoff_DelayJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		backoff  Backoff
+		failures int
+		min      time.Duration
+		max      time.Duration
+	}{
+		{
+			name:     `jitter`,
+			backoff:  Backoff{InitialDelay: 10 * time.Second, Multiplier: 2, MaxDelay: time.Hour, Jitter: 0.2},
+			failures: 2,
+			min:      16 * time.Second,
+			max:      24 * time.Second,
+		},
+		{
+			name:     `full jitter`,
+			backoff:  Backoff{InitialDelay: 10 * time.Second, Multiplier: 2, MaxDelay: time.Hour, Jitter: 1},
+			failures: 1,
+			min:      0,
+			max:      20 * time.Second,
+		},
+		{
+			name:     `jitter does not exceed the cap`,
+			backoff:  Backoff{InitialDelay: 10 * time.Second, Multiplier: 2, MaxDelay: time.Minute, Jitter: 0.5},
+			failures: 10,
+			min:      30 * time.Second,
+			max:      time.Minute,
+		},
+		{
+			name:     `jitter of overflow`,
+			backoff:  Backoff{InitialDelay: 10 * time.Second, Multiplier: 2, Jitter: 1},
+			failures: 5000,
+			min:      0,
+			max:      math.MaxInt64,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spread := false
+			first := test.backoff.Delay(test.failures)
+			for i := 0; i < 1000; i++ {
+				got := test.backoff.Delay(test.failures)
+				if got < test.min || got > test.max {
+					t.Fatalf(`Delay(%d) = %v, want between %v and %v`, test.failures, got, test.min, test.max)
+				}
+				spread = spread || got != first
+			}
+			if !spread {
+				t.Errorf(`Delay(%d) is always %v, jitter is not applied`, test.failures, first)
+			}
+		})
+	}
+}
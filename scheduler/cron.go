@@ -0,0 +1,39 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/procyon-projects/chrono"
+	"strings"
+	"time"
+)
+
+// NormalizeCron converts a standard 5 fields cron expression (minute hour day month weekday)
+// to the 6 fields format with seconds and validates it.
+func NormalizeCron(expression string) (string, error) {
+	fields := strings.Fields(expression)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{`0`}, fields...)
+	case 6:
+	default:
+		return ``, fmt.Errorf(`cron expression must consist of 5 or 6 fields: found %d in "%s"`, len(fields), expression)
+	}
+	normalized := strings.Join(fields, ` `)
+	if _, err := chrono.ParseCronExpression(normalized); err != nil {
+		return ``, err
+	}
+	return normalized, nil
+}
+
+// NextCronTime returns the next time after t that matches the cron expression.
+func NextCronTime(expression string, t time.Time) (time.Time, error) {
+	expression, err := NormalizeCron(expression)
+	if err != nil {
+		return time.Time{}, err
+	}
+	cron, err := chrono.ParseCronExpression(expression)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cron.NextTime(t), nil
+}
@@ -9,11 +9,24 @@ import (
 	"time"
 )
 
+// Job is a periodic run registered in the Scheduler.
+type Job interface {
+	Cancel()
+	IsCancelled() bool
+}
+
 type Scheduler interface {
 	io.Closer
-	Execute(func() error)
-	Schedule(func() error, time.Duration)
+	// Execute runs the func once as soon as possible, an error is returned if the run cannot be scheduled.
+	Execute(func() error) error
+	Schedule(func() error, time.Duration) (Job, error)
+	// ScheduleWithNextDelay runs the func after the initial delay, each run returns the delay before the next one.
+	ScheduleWithNextDelay(func() (time.Duration, error), time.Duration) (Job, error)
+	// ScheduleWithCron runs the func according to the cron expression (5 or 6 fields).
+	ScheduleWithCron(func() error, string) (Job, error)
 	WaitError() error
+	// Shutdown stops starting new runs and waits for in-flight runs until ctx is done.
+	Shutdown(ctx context.Context) error
 }
 
 func NewAppScheduler(errChan chan error) Scheduler {
@@ -22,13 +35,18 @@ func NewAppScheduler(errChan chan error) Scheduler {
 	return &appScheduler{
 		scheduler: scheduler,
 		errChan:   errChan,
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
 	}
 }
 
 type appScheduler struct {
-	scheduler chrono.TaskScheduler
-	errChan   chan error
-	wg        sync.WaitGroup
+	scheduler    chrono.TaskScheduler
+	errChan      chan error
+	wg           sync.WaitGroup
+	shutdownOnce sync.Once
+	done         chan struct{}
+	stopped      chan struct{}
 }
 
 func (a *appScheduler) WaitError() error {
@@ -39,37 +57,142 @@ func (a *appScheduler) String() string {
 	return "appScheduler"
 }
 
-func (a *appScheduler) Execute(f func() error) {
+func (a *appScheduler) reportError(err error) {
+	select {
+	case a.errChan <- err:
+	case <-a.done:
+		log.WithError(err).Warn(`scheduler is shut down, error is ignored`)
+	}
+}
+
+func (a *appScheduler) Execute(f func() error) error {
 	_, err := a.scheduler.Schedule(func(ctx context.Context) {
 		a.wg.Add(1)
 		if err := f(); err != nil {
-			a.errChan <- err
+			a.reportError(err)
 		}
 		a.wg.Done()
 	})
 	if err != nil {
 		log.WithError(err).Errorf(`error while executing task`)
 	}
+	return err
 }
 
-func (a *appScheduler) Schedule(f func() error, d time.Duration) {
+func (a *appScheduler) Schedule(f func() error, d time.Duration) (Job, error) {
 	now := time.Now()
 	startTime := now.Add(d)
-	_, err := a.scheduler.ScheduleWithFixedDelay(func(ctx context.Context) {
+	return a.scheduler.ScheduleWithFixedDelay(func(ctx context.Context) {
 		a.wg.Add(1)
 		if err := f(); err != nil {
-			a.errChan <- err
+			a.reportError(err)
 		}
 		a.wg.Done()
 	}, d, chrono.WithTime(startTime))
+}
+
+func (a *appScheduler) ScheduleWithNextDelay(f func() (time.Duration, error), d time.Duration) (Job, error) {
+	job := &delayedJob{}
+
+	var run chrono.Task
+	schedule := func(delay time.Duration) error {
+		task, err := a.scheduler.Schedule(run, chrono.WithTime(time.Now().Add(delay)))
+		if err != nil {
+			return err
+		}
+		job.set(task)
+		return nil
+	}
+
+	run = func(ctx context.Context) {
+		a.wg.Add(1)
+		defer a.wg.Done()
+
+		if job.IsCancelled() {
+			return
+		}
+		next, err := f()
+		if err != nil {
+			a.reportError(err)
+			return
+		}
+		if job.IsCancelled() || a.scheduler.IsShutdown() {
+			return
+		}
+		if err = schedule(next); err != nil {
+			a.reportError(err)
+		}
+	}
+
+	if err := schedule(d); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
 
+func (a *appScheduler) ScheduleWithCron(f func() error, expression string) (Job, error) {
+	expression, err := NormalizeCron(expression)
 	if err != nil {
-		a.errChan <- err
+		return nil, err
+	}
+	return a.scheduler.ScheduleWithCron(func(ctx context.Context) {
+		a.wg.Add(1)
+		if err := f(); err != nil {
+			a.reportError(err)
+		}
+		a.wg.Done()
+	}, expression)
+}
+
+func (a *appScheduler) Shutdown(ctx context.Context) error {
+	a.shutdownOnce.Do(func() {
+		close(a.done)
+		go func() {
+			<-a.scheduler.Shutdown()
+			a.wg.Wait()
+			close(a.stopped)
+		}()
+	})
+
+	select {
+	case <-a.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
 func (a *appScheduler) Close() error {
-	<-a.scheduler.Shutdown()
-	a.wg.Wait()
-	return nil
+	return a.Shutdown(context.Background())
+}
+
+// delayedJob is a chain of one-shot runs, each of them schedules the next one.
+type delayedJob struct {
+	mu        sync.Mutex
+	cancelled bool
+	current   chrono.ScheduledTask
+}
+
+func (j *delayedJob) set(task chrono.ScheduledTask) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.current = task
+	if j.cancelled {
+		task.Cancel()
+	}
+}
+
+func (j *delayedJob) Cancel() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.cancelled = true
+	if j.current != nil {
+		j.current.Cancel()
+	}
+}
+
+func (j *delayedJob) IsCancelled() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.cancelled
 }
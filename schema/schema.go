@@ -0,0 +1,227 @@
+package schema
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// schemaUrl is the location of the parsed schema in the compiler, local $refs are resolved against it.
+const schemaUrl = `file:///config.schema.json`
+
+// Schema is a compiled JSON Schema, YAML documents are validated against it and problems are reported at their lines.
+type Schema struct {
+	schema *jsonschema.Schema
+}
+
+// Error is a problem of the YAML document, Path is like `tasks[0].auth`.
+// Property is the missing or unknown property of the object at the Path.
+type Error struct {
+	Path     string
+	Property string
+	Line     int
+	Message  string
+}
+
+func (e Error) Error() string {
+	if len(e.Path) == 0 {
+		return fmt.Sprintf(`line %d: %s`, e.Line, e.Message)
+	}
+	return fmt.Sprintf(`line %d: %s: %s`, e.Line, e.Path, e.Message)
+}
+
+// Parse compiles the schema, it is checked against the meta-schema of its draft (the latest one if it is not set).
+func Parse(content []byte) (*Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(schemaUrl, bytes.NewReader(content)); err != nil {
+		return nil, err
+	}
+	compiled, err := compiler.Compile(schemaUrl)
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{schema: compiled}, nil
+}
+
+// Validate checks the YAML document against the schema and returns all problems sorted by line.
+func (s *Schema) Validate(document *yaml.Node) []Error {
+	node := document
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	d := &decoder{
+		values: map[string]decodedNode{},
+		keys:   map[string]*yaml.Node{},
+	}
+	err := s.schema.Validate(d.decode(node, ``, ``))
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return []Error{{Line: node.Line, Message: err.Error()}}
+	}
+	var errs []Error
+	for _, leaf := range leaves(validationErr) {
+		errs = append(errs, d.errors(leaf)...)
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Line != errs[j].Line {
+			return errs[i].Line < errs[j].Line
+		}
+		if errs[i].Path != errs[j].Path {
+			return errs[i].Path < errs[j].Path
+		}
+		return errs[i].Property < errs[j].Property
+	})
+	return errs
+}
+
+// leaves returns the errors of the failed keywords, the rest of the errors only group them.
+func leaves(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+	var result []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		result = append(result, leaves(cause)...)
+	}
+	return result
+}
+
+// decodedNode is the YAML node of the JSON value, path is like `tasks[0].auth`.
+type decodedNode struct {
+	node *yaml.Node
+	path string
+}
+
+// decoder converts YAML nodes to JSON values and remembers the node of every JSON pointer,
+// so the instance locations of the validation errors are mapped to the lines of the document.
+type decoder struct {
+	values map[string]decodedNode
+	// keys are nodes of property names by JSON pointers of their values
+	keys map[string]*yaml.Node
+}
+
+func (d *decoder) decode(node *yaml.Node, pointer string, path string) interface{} {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	d.values[pointer] = decodedNode{node: node, path: path}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		object := make(map[string]interface{}, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if value.ShortTag() == `!!null` {
+				// an empty property is the same as a missing one
+				continue
+			}
+			keyPointer := pointer + `/` + escapePointer(key.Value)
+			keyPath := key.Value
+			if len(path) > 0 {
+				keyPath = path + `.` + key.Value
+			}
+			d.keys[keyPointer] = key
+			object[key.Value] = d.decode(value, keyPointer, keyPath)
+		}
+		return object
+	case yaml.SequenceNode:
+		array := make([]interface{}, 0, len(node.Content))
+		for i, item := range node.Content {
+			array = append(array, d.decode(item, fmt.Sprintf(`%s/%d`, pointer, i), fmt.Sprintf(`%s[%d]`, path, i)))
+		}
+		return array
+	}
+	return scalarValue(node)
+}
+
+// scalarValue returns the JSON value of the YAML scalar, values without JSON types (like timestamps) are strings.
+func scalarValue(node *yaml.Node) interface{} {
+	switch node.ShortTag() {
+	case `!!null`:
+		return nil
+	case `!!bool`:
+		var value bool
+		if err := node.Decode(&value); err == nil {
+			return value
+		}
+	case `!!int`:
+		var value interface{}
+		if err := node.Decode(&value); err == nil {
+			return value
+		}
+	case `!!float`:
+		var value float64
+		if err := node.Decode(&value); err == nil && !math.IsNaN(value) && !math.IsInf(value, 0) {
+			return value
+		}
+	}
+	return node.Value
+}
+
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, `~`, `~0`), `/`, `~1`)
+}
+
+var quotedNamePattern = regexp.MustCompile(`'((?:[^'\\]|\\.)*)'`)
+
+// errors converts the error of the failed keyword. Missing and unknown properties are reported one by one,
+// unknown ones at the lines of their names.
+func (d *decoder) errors(err *jsonschema.ValidationError) []Error {
+	value, found := d.values[err.InstanceLocation]
+	if !found {
+		return []Error{{Message: err.Message}}
+	}
+
+	keyword := err.KeywordLocation[strings.LastIndex(err.KeywordLocation, `/`)+1:]
+	if keyword != `required` && keyword != `additionalProperties` {
+		return []Error{{Path: value.path, Line: value.node.Line, Message: err.Message}}
+	}
+
+	var errs []Error
+	for _, match := range quotedNamePattern.FindAllStringSubmatch(err.Message, -1) {
+		name := unquoteName(match[1])
+		if keyword == `required` {
+			errs = append(errs, Error{
+				Path:     value.path,
+				Property: name,
+				Line:     value.node.Line,
+				Message:  fmt.Sprintf(`missing required property "%s"`, name),
+			})
+			continue
+		}
+		line := value.node.Line
+		if key, found := d.keys[err.InstanceLocation+`/`+escapePointer(name)]; found {
+			line = key.Line
+		}
+		errs = append(errs, Error{
+			Path:     value.path,
+			Property: name,
+			Line:     line,
+			Message:  fmt.Sprintf(`unknown property "%s"`, name),
+		})
+	}
+	if len(errs) == 0 {
+		return []Error{{Path: value.path, Line: value.node.Line, Message: err.Message}}
+	}
+	return errs
+}
+
+// unquoteName reverts the quoting of property names in messages of the validator.
+func unquoteName(quoted string) string {
+	name, err := strconv.Unquote(`"` + strings.ReplaceAll(quoted, `\'`, `'`) + `"`)
+	if err != nil {
+		return quoted
+	}
+	return name
+}
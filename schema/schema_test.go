@@ -0,0 +1,245 @@
+package schema
+
+import (
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"testing"
+)
+
+const testSchema = `{
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["tasks"],
+  "properties": {
+    "tasks": {
+      "type": "array",
+      "items": { "$ref": "#/definitions/task" }
+    },
+    "labels": {
+      "type": "object",
+      "additionalProperties": { "type": "string" }
+    }
+  },
+  "definitions": {
+    "task": {
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["name", "url"],
+      "properties": {
+        "name": { "type": "string" },
+        "url": { "type": "string", "pattern": "^https?://" },
+        "intervalSeconds": { "type": "integer", "minimum": 20, "maximum": 3600 },
+        "onError": { "type": "string", "enum": ["continue", "exit"] },
+        "insecure": { "type": ["boolean", "string"] }
+      }
+    }
+  }
+}`
+
+func TestSchema_Validate(t *testing.T) {
+	schema, err := Parse([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		document string
+		errors   []Error
+	}{
+		{
+			name: `valid`,
+			document: `
+tasks:
+  - name: a
+    url: https://example.com/a.git
+    intervalSeconds: 60
+    onError: exit
+    insecure: true
+labels:
+  team: infra
+`,
+		},
+		{
+			name: `empty optional property`,
+			document: `
+tasks:
+  - name: a
+    url: https://example.com/a.git
+    onError:
+`,
+		},
+		{
+			name: `type`,
+			document: `
+tasks:
+  - name: [a, b]
+    url: https://example.com/a.git
+    intervalSeconds: "60"
+    insecure: 1
+`,
+			errors: []Error{
+				{Path: `tasks[0].name`, Line: 3, Message: `expected string, but got array`},
+				{Path: `tasks[0].intervalSeconds`, Line: 5, Message: `expected integer, but got string`},
+				{Path: `tasks[0].insecure`, Line: 6, Message: `expected boolean or string, but got number`},
+			},
+		},
+		{
+			name: `root type`,
+			document: `
+- name: a
+`,
+			errors: []Error{
+				{Line: 2, Message: `expected object, but got array`},
+			},
+		},
+		{
+			name: `required`,
+			document: `
+tasks:
+  - name: a
+  - url: https://example.com/b.git
+`,
+			errors: []Error{
+				{Path: `tasks[0]`, Property: `url`, Line: 3, Message: `missing required property "url"`},
+				{Path: `tasks[1]`, Property: `name`, Line: 4, Message: `missing required property "name"`},
+			},
+		},
+		{
+			name: `required root property`,
+			document: `
+labels: {}
+`,
+			errors: []Error{
+				{Property: `tasks`, Line: 2, Message: `missing required property "tasks"`},
+			},
+		},
+		{
+			name: `enum`,
+			document: `
+tasks:
+  - name: a
+    url: https://example.com/a.git
+    onError: explode
+`,
+			errors: []Error{
+				{Path: `tasks[0].onError`, Line: 5, Message: `value must be one of "continue", "exit"`},
+			},
+		},
+		{
+			name: `pattern, minimum and maximum`,
+			document: `
+tasks:
+  - name: a
+    url: ftp://example.com/a.git
+    intervalSeconds: 10
+  - name: b
+    url: http://example.com/b.git
+    intervalSeconds: 7200
+`,
+			errors: []Error{
+				{Path: `tasks[0].url`, Line: 4, Message: `does not match pattern '^https?://'`},
+				{Path: `tasks[0].intervalSeconds`, Line: 5, Message: `must be >= 20 but found 10`},
+				{Path: `tasks[1].intervalSeconds`, Line: 8, Message: `must be <= 3600 but found 7200`},
+			},
+		},
+		{
+			name: `additional properties`,
+			document: `
+tasks:
+  - name: a
+    url: https://example.com/a.git
+    foo: 1
+labels:
+  team: infra
+  size: 3
+bar: true
+`,
+			errors: []Error{
+				{Path: `tasks[0]`, Property: `foo`, Line: 5, Message: `unknown property "foo"`},
+				{Path: `labels.size`, Line: 8, Message: `expected string, but got number`},
+				{Property: `bar`, Line: 9, Message: `unknown property "bar"`},
+			},
+		},
+		{
+			name: `alias`,
+			document: `
+tasks:
+  - &task
+    name: a
+    url: https://example.com/a.git
+  - *task
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			document := &yaml.Node{}
+			if err := yaml.Unmarshal([]byte(test.document), document); err != nil {
+				t.Fatal(err)
+			}
+			errors := schema.Validate(document)
+			if len(errors) == 0 && len(test.errors) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(errors, test.errors) {
+				t.Errorf("errors:\n%v\nexpected:\n%v", errors, test.errors)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+	}{
+		{name: `not json`, schema: `{`},
+		{name: `bad pattern`, schema: `{"properties": {"a": {"pattern": "("}}}`},
+		{name: `bad additional properties`, schema: `{"additionalProperties": "yes"}`},
+		{name: `bad type`, schema: `{"type": 1}`},
+		{name: `unresolved reference`, schema: `{"properties": {"a": {"$ref": "#/definitions/missing"}}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Parse([]byte(test.schema)); err == nil {
+				t.Error(`error is expected`)
+			}
+		})
+	}
+}
+
+func TestSchema_ValidateKeywords(t *testing.T) {
+	schema, err := Parse([]byte(`{
+  "type": "object",
+  "properties": {
+    "tags": { "type": "array", "minItems": 1 },
+    "mode": { "const": "sync" },
+    "retry": {
+      "oneOf": [
+        { "type": "integer" },
+        { "type": "object", "required": ["count"] }
+      ]
+    }
+  }
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document := &yaml.Node{}
+	if err = yaml.Unmarshal([]byte(`
+tags: []
+mode: publish
+retry: 3
+`), document); err != nil {
+		t.Fatal(err)
+	}
+	expected := []Error{
+		{Path: `tags`, Line: 2, Message: `minimum 1 items required, but found 0 items`},
+		{Path: `mode`, Line: 3, Message: `value must be "sync"`},
+	}
+	if errors := schema.Validate(document); !reflect.DeepEqual(errors, expected) {
+		t.Errorf("errors:\n%v\nexpected:\n%v", errors, expected)
+	}
+}
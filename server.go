@@ -1,14 +1,16 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 	"net/http"
+	"time"
 )
 
-func startServer(port int) error {
+func newServer(port int, stallTimeout time.Duration) *http.Server {
 
 	http.Handle(`/metrics`, promhttp.InstrumentMetricHandler(
 		prometheus.DefaultRegisterer,
@@ -32,18 +34,55 @@ func startServer(port int) error {
 	})
 
 	http.HandleFunc(`/health/live`, func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
+		stalled := appTasks.stalled(stallTimeout)
+		status := http.StatusOK
+		if len(stalled) > 0 {
+			status = http.StatusServiceUnavailable
+		}
+		writeJson(w, status, map[string]interface{}{
+			`live`:         len(stalled) == 0,
+			`stalledTasks`: stalled,
+		})
 	})
 
 	http.HandleFunc(`/health/ready`, func(w http.ResponseWriter, r *http.Request) {
-		// TODO: switch to ready after first clone
-		w.WriteHeader(http.StatusOK)
+		notReady := appTasks.notReady()
+		status := http.StatusOK
+		if len(notReady) > 0 {
+			status = http.StatusServiceUnavailable
+		}
+		writeJson(w, status, map[string]interface{}{
+			`ready`:         len(notReady) == 0,
+			`notReadyTasks`: notReady,
+		})
 	})
 
+	registerApi(http.DefaultServeMux)
+
+	http.HandleFunc(webhooksPath, webhookHandler)
+
+	return &http.Server{
+		Addr: fmt.Sprintf(`:%d`, port),
+	}
+}
+
+func writeJson(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set(`Content-Type`, `application/json`)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.WithError(err).Warn(`unable to write http response`)
+	}
+}
+
+func startServer(server *http.Server) error {
+
 	log.WithFields(log.Fields{
-		`port`: port,
+		`addr`: server.Addr,
 	}).Info(`start http server`)
 
-	addr := fmt.Sprintf(`:%d`, port)
-	return http.ListenAndServe(addr, nil)
+	err := server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
 }
@@ -1,23 +1,52 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"github.com/go-git/go-git/v5"
+	gitConfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/memory"
 	log "github.com/sirupsen/logrus"
 	"io/fs"
 	"os"
+	"path/filepath"
 	. "registry.fozzy.lan/palefat/git-sync-go/errors"
+	. "registry.fozzy.lan/palefat/git-sync-go/git"
+	"sort"
+	"time"
 )
 
 type GitSyncTask interface {
-	CloneOrAttach() error
+	// CloneOrAttach clones the repo or attaches to the repo on the disk, attached is false for a fresh clone.
+	CloneOrAttach() (attached bool, err error)
 	Pull() error
+	Head() (*plumbing.Reference, error)
+	// Commits returns up to limit commits reachable from HEAD that are not older than since (exclusive), newest first.
+	Commits(since plumbing.Hash, limit int) ([]*object.Commit, error)
 }
 
 type gitSyncTask struct {
-	config *TaskConfig
-	repo   *git.Repository
+	config  *TaskConfig
+	repo    *git.Repository
+	tag     string
+	fetched ByteCounter
+	// verified and rejected are the last revisions whose signatures have been checked,
+	// a rejected revision is not checked again until the remote ref or the keys change
+	verified    signedRevision
+	rejected    signedRevision
+	rejectedErr error
+}
+
+// signedRevision is the commit (and the tag for tag references) checked with the keys (their checksum).
+type signedRevision struct {
+	commit plumbing.Hash
+	tag    string
+	keys   [sha256.Size]byte
 }
 
 func NewGitSyncTask(config *TaskConfig) (GitSyncTask, error) {
@@ -26,6 +55,15 @@ func NewGitSyncTask(config *TaskConfig) (GitSyncTask, error) {
 	}, nil
 }
 
+// context makes go-git calls count bytes received from the remote.
+func (task *gitSyncTask) context() context.Context {
+	return WithByteCounter(context.Background(), &task.fetched)
+}
+
+func (task *gitSyncTask) reportFetched() {
+	fetchedBytesTotal.WithLabelValues(task.config.Name).Add(float64(task.fetched.Reset()))
+}
+
 func (task *gitSyncTask) createDir() error {
 
 	gitUrl := task.config.Url
@@ -116,7 +154,7 @@ func (task *gitSyncTask) attach(cloneOpts *git.CloneOptions) (*git.Repository, e
 		return nil, err
 	}
 
-	if len(targetRef) > 0 {
+	if len(targetRef) > 0 && !task.config.TracksTags() {
 		localRef := head.Name()
 		if targetRef != localRef {
 			errMsg := `local reference and target reference are different`
@@ -139,7 +177,7 @@ func (task *gitSyncTask) attach(cloneOpts *git.CloneOptions) (*git.Repository, e
 }
 
 func (task *gitSyncTask) doClone(cloneOpts *git.CloneOptions) (*git.Repository, error) {
-	repo, err := git.PlainClone(task.config.Path, false, cloneOpts)
+	repo, err := git.PlainCloneContext(task.context(), task.config.Path, false, cloneOpts)
 	if err == nil || err == git.ErrRepositoryAlreadyExists {
 		return repo, err
 	}
@@ -152,8 +190,10 @@ func (task *gitSyncTask) doClone(cloneOpts *git.CloneOptions) (*git.Repository,
 
 	// FIXME: go-git cannot clone a git repository from Azure DevOps
 	// manual clone
+	manualCloneFallbacksTotal.WithLabelValues(task.config.Name).Inc()
 
-	cmd, err := task.config.GitCloneCmd()
+	cmd, cleanup, err := task.config.GitCloneCmd()
+	defer cleanup()
 	if err != nil {
 		return nil, err
 	}
@@ -163,17 +203,18 @@ func (task *gitSyncTask) doClone(cloneOpts *git.CloneOptions) (*git.Repository,
 		return nil, err
 	}
 
-	return nil, git.ErrRepositoryAlreadyExists
+	return git.PlainOpen(task.config.Path)
 }
 
-func (task *gitSyncTask) CloneOrAttach() error {
+func (task *gitSyncTask) CloneOrAttach() (bool, error) {
+	defer task.reportFetched()
 
 	if len(task.config.Url) == 0 {
-		return ErrGitRepoUrlIsMissing
+		return false, ErrGitRepoUrlIsMissing
 	}
 
 	if err := task.createDir(); err != nil {
-		return err
+		return false, err
 	}
 
 	// TODO: check if directory contains files
@@ -181,15 +222,24 @@ func (task *gitSyncTask) CloneOrAttach() error {
 
 	cloneOpts, err := task.config.CloneOptions()
 	if err != nil {
-		return err
+		return false, err
+	}
+
+	var tag string
+	if task.config.TracksTags() {
+		if tag, err = task.latestTag(); err != nil {
+			return false, err
+		}
+		cloneOpts.ReferenceName = plumbing.NewTagReferenceName(tag)
 	}
 
 	repo, err := task.doClone(cloneOpts)
-	if err == git.ErrRepositoryAlreadyExists {
+	attached := err == git.ErrRepositoryAlreadyExists
+	if attached {
 
 		repo, err = task.attach(cloneOpts)
 		if err != nil {
-			return err
+			return false, err
 		}
 
 	} else if err != nil {
@@ -203,12 +253,33 @@ func (task *gitSyncTask) CloneOrAttach() error {
 			`target_ref`: cloneOpts.ReferenceName,
 		}).Error(errMsg)
 
-		return fmt.Errorf(errMsg)
+		return false, fmt.Errorf(errMsg)
+	}
+
+	task.repo = repo
+
+	if len(task.config.Sparse) > 0 {
+		if err = task.sparseCheckout(); err != nil {
+			return false, err
+		}
+	}
+
+	if hash, pinned := task.config.PinnedCommit(); pinned {
+		err = task.checkoutCommit(repo, hash, ``)
+	} else if task.config.TracksTags() {
+		err = task.checkoutTag(repo, tag)
+	} else if task.config.Verify != nil {
+		err = task.checkoutVerified(cloneOpts.ReferenceName)
+	} else if len(task.config.Sparse) > 0 {
+		err = task.checkoutSparse()
+	}
+	if err != nil {
+		return false, err
 	}
 
 	head, err := repo.Head()
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	if log.IsLevelEnabled(log.DebugLevel) {
@@ -222,12 +293,586 @@ func (task *gitSyncTask) CloneOrAttach() error {
 		}).Debug(`repo has been cloned`)
 	}
 
-	task.repo = repo
+	return attached, task.publish()
+}
+
+// sparseCheckout applies the sparse dirs to the worktree, files outside of them are deleted.
+func (task *gitSyncTask) sparseCheckout() error {
+	logger := log.WithFields(log.Fields{
+		`name`:   task.config.Name,
+		`url`:    task.config.Url,
+		`path`:   task.config.Path,
+		`sparse`: task.config.Sparse,
+	})
+
+	if err := SparseCheckout(task.context(), task.config.Path, task.config.Sparse); err != nil {
+		logger.WithError(err).Error(`unable to apply sparse checkout`)
+		return err
+	}
+
+	logger.Debug(`sparse checkout has been applied`)
+	return nil
+}
+
+// checkoutSparse checks out HEAD by the git cli, since the repo is cloned by go-git without checkout.
+func (task *gitSyncTask) checkoutSparse() error {
+	worktree, err := task.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	return task.reset(worktree, plumbing.ZeroHash, git.HardReset)
+}
 
+// checkoutVerified moves the worktree to the remote ref once its revision is verified. Repos of verified tasks
+// are cloned without checkout, so HEAD is checked out after that if the index does not match it:
+// the clone may have been rejected or interrupted before the checkout by a previous run.
+func (task *gitSyncTask) checkoutVerified(refName plumbing.ReferenceName) error {
+	worktree, err := task.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	err = task.pullRemote(worktree, refName)
+	switch err {
+	case git.ErrNonFastForwardUpdate:
+		return task.handleForcePush(worktree, refName)
+	case git.NoErrAlreadyUpToDate:
+		checkedOut, err := isCheckedOut(worktree)
+		if err != nil || checkedOut {
+			return err
+		}
+		return task.reset(worktree, plumbing.ZeroHash, git.HardReset)
+	}
 	return err
 }
 
+// isCheckedOut tells if the index matches HEAD, the index of a repo cloned without checkout is empty.
+func isCheckedOut(worktree *git.Worktree) (bool, error) {
+	status, err := worktree.Status()
+	if err != nil {
+		return false, err
+	}
+	for _, fileStatus := range status {
+		if fileStatus.Staging != git.Unmodified && fileStatus.Staging != git.Untracked {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// checkoutCommit moves HEAD of the repo to the commit (detached HEAD), the tag is verified instead of the commit if it is set.
+// Ref specs (all remote branches and tags by default) are fetched if the commit is not found locally.
+func (task *gitSyncTask) checkoutCommit(repo *git.Repository, hash plumbing.Hash, tag string, refSpecs ...gitConfig.RefSpec) error {
+	_, err := repo.CommitObject(hash)
+	if err == plumbing.ErrObjectNotFound {
+
+		log.WithFields(log.Fields{
+			`name`:   task.config.Name,
+			`url`:    task.config.Url,
+			`path`:   task.config.Path,
+			`commit`: hash,
+		}).Info(`commit is not found locally, fetch the remote`)
+
+		fetchOptions, err := task.config.FetchOptions(refSpecs...)
+		if err != nil {
+			return err
+		}
+
+		err = repo.FetchContext(task.context(), fetchOptions)
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return err
+		}
+
+		_, err = repo.CommitObject(hash)
+	}
+	if err != nil {
+
+		log.WithError(err).WithFields(log.Fields{
+			`name`:   task.config.Name,
+			`url`:    task.config.Url,
+			`path`:   task.config.Path,
+			`commit`: hash,
+		}).Error(`unable to find the commit`)
+
+		return err
+	}
+
+	if err = task.verifyRevision(hash, tag); err != nil {
+		return err
+	}
+
+	if len(task.config.Sparse) > 0 {
+		return SparseCheckoutCommit(task.context(), task.config.Path, hash.String())
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	return worktree.Checkout(&git.CheckoutOptions{
+		Hash:  hash,
+		Force: true,
+	})
+}
+
+// reset moves HEAD to the commit (the current HEAD if the commit is zero).
+// Sparse worktrees are reset by the git cli, so files outside of the sparse dirs are not written.
+func (task *gitSyncTask) reset(worktree *git.Worktree, commit plumbing.Hash, mode git.ResetMode) error {
+	if len(task.config.Sparse) == 0 {
+		return worktree.Reset(&git.ResetOptions{
+			Commit: commit,
+			Mode:   mode,
+		})
+	}
+	revision := plumbing.HEAD.String()
+	if !commit.IsZero() {
+		revision = commit.String()
+	}
+	return SparseReset(task.context(), task.config.Path, revision, mode == git.HardReset)
+}
+
+// pullCommit verifies that the worktree still sits on the pinned commit instead of pulling.
+func (task *gitSyncTask) pullCommit() error {
+	repo := task.repo
+	hash, _ := task.config.PinnedCommit()
+
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+
+	if head.Name() == plumbing.HEAD && head.Hash() == hash {
+
+		worktree, err := repo.Worktree()
+		if err != nil {
+			return err
+		}
+
+		err = task.reset(worktree, plumbing.ZeroHash, git.HardReset)
+		if err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			`name`:   task.config.Name,
+			`url`:    task.config.Url,
+			`path`:   task.config.Path,
+			`commit`: hash,
+		}).Debug(`repo is on the pinned commit`)
+
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		`name`:      task.config.Name,
+		`url`:       task.config.Url,
+		`path`:      task.config.Path,
+		`commit`:    hash,
+		`local_ref`: head.Name(),
+		`local_sha`: head.Hash(),
+	}).Warn(`repo has moved from the pinned commit, checkout it again`)
+
+	return task.checkoutCommit(repo, hash, ``)
+}
+
+// latestTag lists the remote tags and selects the newest one that matches semver and/or tagPattern.
+func (task *gitSyncTask) latestTag() (string, error) {
+	selector, err := task.config.TagSelector()
+	if err != nil {
+		return ``, err
+	}
+
+	listOptions, err := task.config.ListOptions()
+	if err != nil {
+		return ``, err
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &gitConfig.RemoteConfig{
+		Name: task.config.remoteName(),
+		URLs: []string{task.config.Url},
+	})
+
+	refs, err := remote.ListContext(task.context(), listOptions)
+	if err != nil {
+		return ``, err
+	}
+
+	tags := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		if ref.Name().IsTag() {
+			tags = append(tags, ref.Name().Short())
+		}
+	}
+
+	tag, found := selector.Select(tags)
+	if !found {
+		return ``, fmt.Errorf(`there is no remote tag that matches %s`, selector)
+	}
+
+	return tag, nil
+}
+
+// checkoutTag fetches the tag and moves HEAD of the repo to the tagged commit (detached HEAD).
+func (task *gitSyncTask) checkoutTag(repo *git.Repository, tag string) error {
+	refName := plumbing.NewTagReferenceName(tag)
+	refSpec := gitConfig.RefSpec(fmt.Sprintf(`+%s:%s`, refName, refName))
+
+	fetchOptions, err := task.config.FetchOptions(refSpec)
+	if err != nil {
+		return err
+	}
+
+	err = repo.FetchContext(task.context(), fetchOptions)
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	ref, err := repo.Reference(refName, true)
+	if err != nil {
+		return err
+	}
+
+	hash := ref.Hash()
+	if tagObject, err := repo.TagObject(hash); err == nil {
+		commit, err := tagObject.Commit()
+		if err != nil {
+			return err
+		}
+		hash = commit.Hash
+	}
+
+	if err = task.checkoutCommit(repo, hash, tag, refSpec); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		`name`:    task.config.Name,
+		`url`:     task.config.Url,
+		`path`:    task.config.Path,
+		`old_tag`: task.tag,
+		`new_tag`: tag,
+		`commit`:  hash,
+	}).Info(`tag has been checked out`)
+
+	task.tag = tag
+
+	return nil
+}
+
+// pullTag checks out the newest matching tag if it has changed since the last run.
+func (task *gitSyncTask) pullTag() error {
+	repo := task.repo
+
+	tag, err := task.latestTag()
+	if err != nil {
+		return err
+	}
+
+	if tag != task.tag {
+		return task.checkoutTag(repo, tag)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	err = task.reset(worktree, plumbing.ZeroHash, git.HardReset)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		`name`: task.config.Name,
+		`url`:  task.config.Url,
+		`path`: task.config.Path,
+		`tag`:  tag,
+	}).Debug(`repo is on the newest tag`)
+
+	return nil
+}
+
+func (task *gitSyncTask) Head() (*plumbing.Reference, error) {
+	if task.repo == nil {
+		return nil, fmt.Errorf(`repo is not cloned yet`)
+	}
+	return task.repo.Head()
+}
+
+func (task *gitSyncTask) Commits(since plumbing.Hash, limit int) ([]*object.Commit, error) {
+	if task.repo == nil {
+		return nil, fmt.Errorf(`repo is not cloned yet`)
+	}
+	head, err := task.repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	iter, err := task.repo.Log(&git.LogOptions{
+		From: head.Hash(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	commits := make([]*object.Commit, 0, limit)
+	err = iter.ForEach(func(commit *object.Commit) error {
+		if commit.Hash == since || len(commits) >= limit {
+			return storer.ErrStop
+		}
+		commits = append(commits, commit)
+		return nil
+	})
+	return commits, err
+}
+
 func (task *gitSyncTask) Pull() error {
+	defer task.reportFetched()
+	pull, err := task.handleLocalChanges()
+	if err != nil || !pull {
+		return err
+	}
+	if err = task.pull(); err != nil {
+		return err
+	}
+	if err = task.clean(); err != nil {
+		return err
+	}
+	return task.publish()
+}
+
+// verifyRevision checks the signature of the commit (or of the tag object for tag references) before it is
+// checked out. A rejected revision fails the sync without checking it again until the remote ref or the keys change.
+func (task *gitSyncTask) verifyRevision(hash plumbing.Hash, tag string) error {
+	if task.config.Verify == nil {
+		return nil
+	}
+	gpg, sshAllowedSigners, err := task.config.Verify.keys()
+	if err != nil {
+		return err
+	}
+	revision := signedRevision{
+		commit: hash,
+		tag:    tag,
+		keys:   sha256.Sum256([]byte(gpg + "\x00" + sshAllowedSigners)),
+	}
+	if revision == task.verified {
+		return nil
+	}
+	if revision == task.rejected {
+		return task.rejectedErr
+	}
+
+	verifier, err := NewSignatureVerifier(gpg, sshAllowedSigners)
+	if err != nil {
+		return err
+	}
+
+	logger := log.WithFields(log.Fields{
+		`name`: task.config.Name,
+		`url`:  task.config.Url,
+		`path`: task.config.Path,
+		`sha`:  hash,
+	})
+
+	object := `commit`
+	var signer string
+	var verifyErr error
+	if len(tag) > 0 {
+		object = `tag ` + tag
+		ref, err := task.repo.Tag(tag)
+		if err != nil {
+			return err
+		}
+		tagObject, err := task.repo.TagObject(ref.Hash())
+		if err == plumbing.ErrObjectNotFound {
+			verifyErr = fmt.Errorf(`tag %s is not annotated, it cannot be signed`, tag)
+		} else if err != nil {
+			return err
+		} else {
+			signer, verifyErr = verifier.VerifyTag(tagObject)
+		}
+	} else {
+		commit, err := task.repo.CommitObject(hash)
+		if err != nil {
+			return err
+		}
+		signer, verifyErr = verifier.VerifyCommit(commit)
+	}
+
+	if verifyErr != nil {
+		err = &SignatureError{Object: object, Sha: hash.String(), Err: verifyErr}
+		logger.WithError(err).Error(`revision is not verified, it is not checked out`)
+		task.rejected = revision
+		task.rejectedErr = err
+		return err
+	}
+
+	task.verified = revision
+	logger.WithFields(log.Fields{
+		`signer`: signer,
+	}).Info(`signature has been verified`)
+	return nil
+}
+
+// clean deletes untracked (and ignored) files of the worktree according to the clean config.
+func (task *gitSyncTask) clean() error {
+	clean := task.config.Clean
+	if clean == nil || clean.Mode == CleanNone {
+		return nil
+	}
+
+	logger := log.WithFields(log.Fields{
+		`name`: task.config.Name,
+		`url`:  task.config.Url,
+		`path`: task.config.Path,
+		`mode`: clean.Mode,
+	})
+
+	removed, err := CleanWorktree(task.repo, clean.Mode == CleanUntrackedIgnored, clean.Exclude)
+	if len(removed) > 0 {
+		logger.WithFields(log.Fields{
+			`removed`: removed,
+		}).Debug(`untracked files have been deleted`)
+	}
+	if err != nil {
+		logger.WithError(err).Error(`unable to clean the worktree`)
+	}
+	return err
+}
+
+// handleLocalChanges applies the localChanges policy before the worktree is reset by the pull.
+// It returns false if the pull has to be skipped to keep the changes.
+func (task *gitSyncTask) handleLocalChanges() (bool, error) {
+	worktree, err := task.repo.Worktree()
+	if err != nil {
+		return false, err
+	}
+	status, paths, err := localChanges(task.repo, worktree)
+	if err != nil || len(paths) == 0 {
+		return err == nil, err
+	}
+
+	logger := log.WithFields(log.Fields{
+		`name`:          task.config.Name,
+		`url`:           task.config.Url,
+		`path`:          task.config.Path,
+		`local_changes`: task.config.LocalChanges,
+		`changed_files`: paths,
+	})
+
+	switch task.config.LocalChanges {
+	case LocalChangesFail:
+		logger.Error(`worktree has local changes, the pull is aborted`)
+		return false, &LocalChangesError{Paths: paths}
+	case LocalChangesPreserve:
+		logger.Warn(`worktree has local changes, the pull is skipped`)
+		return false, nil
+	case LocalChangesStash:
+		branch, err := task.stashLocalChanges(worktree, status, paths)
+		if err != nil {
+			logger.WithError(err).Error(`unable to stash local changes`)
+			return false, err
+		}
+		logger.WithFields(log.Fields{
+			`branch`: branch,
+		}).Warn(`local changes have been stashed`)
+		return true, nil
+	default:
+		logger.Warn(`local changes are discarded`)
+		return true, nil
+	}
+}
+
+// localChanges returns paths of tracked files that are changed in the worktree or in the index.
+// Untracked files and files outside of the sparse checkout (go-git reports them as deleted) are not reported.
+func localChanges(repo *git.Repository, worktree *git.Worktree) (git.Status, []string, error) {
+	status, err := worktree.Status()
+	if err != nil {
+		return nil, nil, err
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, nil, err
+	}
+	skipped := make(map[string]bool)
+	for _, entry := range idx.Entries {
+		if entry.SkipWorktree {
+			skipped[entry.Name] = true
+		}
+	}
+	paths := make([]string, 0)
+	for path, fileStatus := range status {
+		if fileStatus.Worktree == git.Untracked || (fileStatus.Worktree == git.Unmodified && fileStatus.Staging == git.Unmodified) {
+			continue
+		}
+		if skipped[path] && fileStatus.Worktree == git.Deleted && fileStatus.Staging == git.Unmodified {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return status, paths, nil
+}
+
+// stashLocalChanges commits the changed files to a new timestamped branch and resets the worktree back to HEAD.
+func (task *gitSyncTask) stashLocalChanges(worktree *git.Worktree, status git.Status, paths []string) (string, error) {
+	head, err := task.repo.Head()
+	if err != nil {
+		return ``, err
+	}
+
+	// the changes stay in the worktree if they cannot be stashed
+	restore := func(err error) (string, error) {
+		_ = task.reset(worktree, head.Hash(), git.MixedReset)
+		return ``, err
+	}
+
+	for _, path := range paths {
+		if status[path].Worktree == git.Deleted {
+			_, err = worktree.Remove(path)
+		} else {
+			_, err = worktree.Add(path)
+		}
+		if err != nil {
+			return restore(err)
+		}
+	}
+
+	now := time.Now()
+	signature := &object.Signature{
+		Name:  `git-sync`,
+		Email: `git-sync@localhost`,
+		When:  now,
+	}
+	hash, err := worktree.Commit(fmt.Sprintf(`git-sync: local changes before the sync at %s`, now.Format(time.RFC3339)), &git.CommitOptions{
+		Author:    signature,
+		Committer: signature,
+	})
+	if err != nil {
+		return restore(err)
+	}
+
+	branch := plumbing.NewBranchReferenceName(`git-sync/stash/` + now.UTC().Format(`20060102T150405.000Z`))
+	if err = task.repo.Storer.SetReference(plumbing.NewHashReference(branch, hash)); err != nil {
+		return restore(err)
+	}
+
+	err = task.reset(worktree, head.Hash(), git.HardReset)
+	if err != nil {
+		return ``, err
+	}
+	return branch.Short(), nil
+}
+
+func (task *gitSyncTask) pull() error {
+	if _, pinned := task.config.PinnedCommit(); pinned {
+		return task.pullCommit()
+	}
+	if task.config.TracksTags() {
+		return task.pullTag()
+	}
+
 	repo := task.repo
 
 	worktree, err := repo.Worktree()
@@ -240,14 +885,19 @@ func (task *gitSyncTask) Pull() error {
 		return err
 	}
 
-	err = worktree.Reset(&git.ResetOptions{
-		Mode: git.HardReset,
-	})
+	err = task.reset(worktree, plumbing.ZeroHash, git.HardReset)
 	if err != nil {
 		return err
 	}
 
-	err = worktree.Pull(pullOptions)
+	if len(task.config.Sparse) > 0 || task.config.Verify != nil {
+		err = task.pullRemote(worktree, pullOptions.ReferenceName)
+	} else {
+		err = worktree.PullContext(task.context(), pullOptions)
+	}
+	if err == git.ErrNonFastForwardUpdate {
+		return task.handleForcePush(worktree, pullOptions.ReferenceName)
+	}
 	if err == git.NoErrAlreadyUpToDate {
 
 		log.WithFields(log.Fields{
@@ -262,3 +912,266 @@ func (task *gitSyncTask) Pull() error {
 
 	return err
 }
+
+// maxDiscardedCommits limits the number of discarded commits in the log
+const maxDiscardedCommits = 20
+
+// handleForcePush applies the onForcePush policy when the remote ref cannot be fast-forwarded,
+// with reset the worktree is moved to the remote commit and local commits that are not in the remote are discarded.
+func (task *gitSyncTask) handleForcePush(worktree *git.Worktree, refName plumbing.ReferenceName) error {
+	if len(refName) == 0 {
+		refName = plumbing.HEAD
+	}
+	logger := log.WithFields(log.Fields{
+		`name`:       task.config.Name,
+		`url`:        task.config.Url,
+		`path`:       task.config.Path,
+		`target_ref`: refName,
+	})
+
+	if task.config.OnForcePush == OnForcePushFail {
+		logger.Error(`history of the remote ref has been rewritten, the pull is aborted`)
+		return git.ErrNonFastForwardUpdate
+	}
+
+	remoteCommit, err := task.remoteCommit(refName)
+	if err != nil {
+		return err
+	}
+	hash := remoteCommit.Hash
+	if err = task.verifyRevision(hash, task.config.Reference.Tag); err != nil {
+		return err
+	}
+
+	head, err := task.repo.Head()
+	if err != nil {
+		return err
+	}
+	discarded, err := task.discardedCommits(head.Hash(), remoteCommit)
+	if err != nil {
+		return err
+	}
+
+	err = task.reset(worktree, hash, git.HardReset)
+	if err != nil {
+		return err
+	}
+
+	logger.WithFields(log.Fields{
+		`old_sha`:   head.Hash(),
+		`new_sha`:   hash,
+		`discarded`: discarded,
+	}).Warn(`history of the remote ref has been rewritten, the worktree has been reset to the remote`)
+	return nil
+}
+
+// pullRemote fast-forwards the worktree to the remote ref by a reset instead of go-git pull: the pull would
+// check out the whole tree of sparse worktrees and it would write the remote revision before it is verified.
+func (task *gitSyncTask) pullRemote(worktree *git.Worktree, refName plumbing.ReferenceName) error {
+	if len(refName) == 0 {
+		refName = plumbing.HEAD
+	}
+	remoteCommit, err := task.remoteCommit(refName)
+	if err != nil {
+		return err
+	}
+	if err = task.verifyRevision(remoteCommit.Hash, task.config.Reference.Tag); err != nil {
+		return err
+	}
+	head, err := task.repo.Head()
+	if err != nil {
+		return err
+	}
+	if head.Hash() == remoteCommit.Hash {
+		return git.NoErrAlreadyUpToDate
+	}
+	headCommit, err := task.repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	fastForward, err := headCommit.IsAncestor(remoteCommit)
+	if err != nil {
+		return err
+	}
+	if !fastForward {
+		return git.ErrNonFastForwardUpdate
+	}
+	return task.reset(worktree, remoteCommit.Hash, git.HardReset)
+}
+
+// remoteCommit returns the commit of the remote ref, the remote is fetched if the commit is not found locally.
+func (task *gitSyncTask) remoteCommit(refName plumbing.ReferenceName) (*object.Commit, error) {
+	hash, err := task.remoteRefHash(refName)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := task.peelCommit(hash)
+	if err != plumbing.ErrObjectNotFound {
+		return commit, err
+	}
+
+	fetchOptions, err := task.config.FetchOptions()
+	if err != nil {
+		return nil, err
+	}
+	err = task.repo.FetchContext(task.context(), fetchOptions)
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, err
+	}
+	return task.peelCommit(hash)
+}
+
+// peelCommit returns the commit of the hash, annotated tags are resolved to their commits,
+// since the remote does not always advertise peeled tags.
+func (task *gitSyncTask) peelCommit(hash plumbing.Hash) (*object.Commit, error) {
+	if tagObject, err := task.repo.TagObject(hash); err == nil {
+		return tagObject.Commit()
+	}
+	return task.repo.CommitObject(hash)
+}
+
+// remoteRefHash returns the commit of the remote ref, symbolic refs like HEAD are resolved.
+func (task *gitSyncTask) remoteRefHash(refName plumbing.ReferenceName) (plumbing.Hash, error) {
+	listOptions, err := task.config.ListOptions()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &gitConfig.RemoteConfig{
+		Name: task.config.remoteName(),
+		URLs: []string{task.config.Url},
+	})
+
+	refs, err := remote.ListContext(task.context(), listOptions)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	// peeled tags (<tag>^{}) point to commits, so they are preferred over annotated tag objects
+	byName := make(map[plumbing.ReferenceName]*plumbing.Reference, len(refs))
+	for _, ref := range refs {
+		byName[ref.Name()] = ref
+	}
+	for i := 0; i < 10; i++ {
+		ref, found := byName[refName]
+		if !found {
+			return plumbing.ZeroHash, fmt.Errorf(`remote ref %s is not found`, refName)
+		}
+		if ref.Type() == plumbing.SymbolicReference {
+			refName = ref.Target()
+			continue
+		}
+		if peeled, found := byName[refName+`^{}`]; found {
+			return peeled.Hash(), nil
+		}
+		return ref.Hash(), nil
+	}
+	return plumbing.ZeroHash, fmt.Errorf(`remote ref %s cannot be resolved`, refName)
+}
+
+// discardedCommits returns short shas of commits that are reachable from the local HEAD, but not from the remote commit.
+func (task *gitSyncTask) discardedCommits(head plumbing.Hash, remoteCommit *object.Commit) ([]string, error) {
+	headCommit, err := task.repo.CommitObject(head)
+	if err != nil {
+		return nil, err
+	}
+	bases, err := headCommit.MergeBase(remoteCommit)
+	if err != nil {
+		return nil, err
+	}
+	stop := make(map[plumbing.Hash]bool, len(bases))
+	for _, base := range bases {
+		stop[base.Hash] = true
+	}
+
+	discarded := make([]string, 0)
+	iter, err := task.repo.Log(&git.LogOptions{From: head})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	err = iter.ForEach(func(commit *object.Commit) error {
+		if stop[commit.Hash] || len(discarded) >= maxDiscardedCommits {
+			return storer.ErrStop
+		}
+		discarded = append(discarded, commit.Hash.String()[:7])
+		return nil
+	})
+	return discarded, err
+}
+
+// publish exports HEAD into its own dir and atomically switches the publish link to it,
+// then old revisions are deleted.
+func (task *gitSyncTask) publish() error {
+	publish := task.config.Publish
+	if publish == nil {
+		return nil
+	}
+
+	head, err := task.repo.Head()
+	if err != nil {
+		return err
+	}
+
+	sha := head.Hash().String()
+	dir, err := filepath.Abs(filepath.Join(publish.Worktrees, sha))
+	if err != nil {
+		return err
+	}
+	link, err := filepath.Abs(publish.Link)
+	if err != nil {
+		return err
+	}
+
+	logger := log.WithFields(log.Fields{
+		`name`:     task.config.Name,
+		`url`:      task.config.Url,
+		`path`:     task.config.Path,
+		`link`:     publish.Link,
+		`revision`: sha,
+	})
+
+	_, err = os.Stat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		commit, err := task.repo.CommitObject(head.Hash())
+		if err != nil {
+			return err
+		}
+		if err = ExportCommit(commit, dir, task.config.Sparse); err != nil {
+			logger.WithError(err).Error(`unable to export the revision`)
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	// the relative target keeps the link valid if the parent dir is mounted somewhere else
+	target, err := filepath.Rel(filepath.Dir(link), dir)
+	if err != nil {
+		target = dir
+	}
+	if current, err := os.Readlink(link); err == nil && current == target {
+		logger.Debug(`revision is already published`)
+		return nil
+	}
+
+	if err = os.MkdirAll(filepath.Dir(link), fs.ModePerm); err != nil {
+		return err
+	}
+	if err = SwapSymlink(link, target); err != nil {
+		logger.WithError(err).Error(`unable to switch the link to the revision`)
+		return err
+	}
+	logger.Info(`revision has been published`)
+
+	removed, err := RemoveOldRevisions(publish.Worktrees, sha, *publish.KeepRevisions)
+	if err != nil {
+		logger.WithError(err).Warn(`unable to delete old revisions`)
+	} else if len(removed) > 0 {
+		logger.WithFields(log.Fields{
+			`removed`: removed,
+		}).Debug(`old revisions have been deleted`)
+	}
+
+	return nil
+}
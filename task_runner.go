@@ -0,0 +1,432 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	log "github.com/sirupsen/logrus"
+	. "registry.fozzy.lan/palefat/git-sync-go/errors"
+	. "registry.fozzy.lan/palefat/git-sync-go/scheduler"
+	"strings"
+	"sync"
+	"time"
+)
+
+// taskRunner applies the failure policy of the task to its runs and tracks the task status.
+type taskRunner struct {
+	config   *TaskConfig
+	task     GitSyncTask
+	status   taskStatus
+	attached bool
+	// existing is set if the repo has been on the disk before the task attached to it
+	existing bool
+	failures int
+	stopped  bool
+	mu       sync.Mutex
+	job      Job
+	callMu   sync.Mutex
+	call     *runCall
+	// queued is the follow-up of the in-flight call, it is triggered after the in-flight run has started
+	queued *runCall
+	// hookedSha is HEAD of the last successful post-sync hook run
+	hookedSha string
+}
+
+// runCall is a pending or in-flight run, manual triggers wait for a pending run instead of starting another one.
+type runCall struct {
+	done    chan struct{}
+	err     error
+	started bool
+}
+
+func (c *runCall) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *runCall) Err() error {
+	return c.err
+}
+
+func (c *runCall) finished() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func newTaskRunner(config *TaskConfig) (*taskRunner, error) {
+	task, err := NewGitSyncTask(config)
+	if err != nil {
+		return nil, err
+	}
+	return &taskRunner{
+		config: config,
+		task:   task,
+	}, nil
+}
+
+func (r *taskRunner) setJob(job Job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.job = job
+	if r.stopped {
+		job.Cancel()
+	}
+}
+
+// stop cancels the schedule of the task, an in-flight run is finished first.
+func (r *taskRunner) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stopped = true
+	r.status.setStopped()
+	if r.job != nil {
+		r.job.Cancel()
+	}
+	if sha, ref := r.status.head(); len(sha) > 0 {
+		commitInfo.DeleteLabelValues(r.config.Name, sha, ref)
+	}
+}
+
+func (r *taskRunner) sync() error {
+	syncAttemptsTotal.WithLabelValues(r.config.Name).Inc()
+	err := r.doSync()
+	if err != nil {
+		syncFailuresTotal.WithLabelValues(r.config.Name).Inc()
+		return err
+	}
+	syncSuccessesTotal.WithLabelValues(r.config.Name).Inc()
+	lastSuccessTimestampSeconds.WithLabelValues(r.config.Name).SetToCurrentTime()
+	oldSha, _ := r.status.head()
+	r.updateHead()
+	r.runPostSyncHook()
+	r.notifySynced(oldSha)
+	return nil
+}
+
+// runPostSyncHook runs the hook if HEAD differs from HEAD of the last successful hook run,
+// so a failed hook is retried on the next sync. The sync is not failed by the hook.
+func (r *taskRunner) runPostSyncHook() {
+	if r.config.Hooks == nil || r.config.Hooks.PostSync == nil {
+		return
+	}
+	sha, ref := r.status.head()
+	if len(sha) == 0 || sha == r.hookedSha {
+		return
+	}
+	err := runHook(postSyncHook, r.config.Hooks.PostSync, r.config, hookChange{
+		oldSha: r.hookedSha,
+		newSha: sha,
+		ref:    ref,
+	})
+	r.status.hookFinished(err)
+	if err == nil {
+		r.hookedSha = sha
+	}
+}
+
+// seedHookedSha takes HEAD of the repo that is already on the disk, so the post-sync hook is run only
+// when the sync moves HEAD and not on every start. The hook is run with the empty old sha after a fresh clone.
+func (r *taskRunner) seedHookedSha() {
+	if r.config.Hooks == nil || r.config.Hooks.PostSync == nil || len(r.hookedSha) > 0 {
+		return
+	}
+	repo, err := git.PlainOpen(r.config.Path)
+	if err != nil {
+		return
+	}
+	if head, err := repo.Head(); err == nil {
+		r.hookedSha = head.Hash().String()
+	}
+}
+
+func (r *taskRunner) doSync() error {
+	start := time.Now()
+	if !r.attached {
+		r.seedHookedSha()
+		existing, err := r.task.CloneOrAttach()
+		cloneDurationSeconds.WithLabelValues(r.config.Name).Observe(time.Since(start).Seconds())
+		if err != nil {
+			return err
+		}
+		r.attached = true
+		r.existing = existing
+		r.status.setReady()
+		return nil
+	}
+	err := r.task.Pull()
+	pullDurationSeconds.WithLabelValues(r.config.Name).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// notify sends the event to global receivers and receivers of the task.
+func (r *taskRunner) notify(payload *notifyPayload) {
+	receivers := appNotifier.Receivers(r.config.Notify)
+	if len(receivers) == 0 {
+		return
+	}
+	payload.Task = r.config.Name
+	payload.Url = r.config.RedactedUrl()
+	payload.Path = r.config.Path
+	payload.Time = time.Now()
+	appNotifier.Send(receivers, payload)
+}
+
+// notifySynced sends the synced event with new commits if HEAD has moved.
+func (r *taskRunner) notifySynced(oldSha string) {
+	sha, ref := r.status.head()
+	if len(sha) == 0 || sha == oldSha || len(appNotifier.Receivers(r.config.Notify)) == 0 {
+		return
+	}
+
+	// only HEAD is reported after the clone
+	limit := maxNotifyCommits
+	if len(oldSha) == 0 {
+		limit = 1
+	}
+	payload := &notifyPayload{
+		Event:  NotifyEventSynced,
+		Ref:    ref,
+		OldSha: oldSha,
+		NewSha: sha,
+	}
+	commits, err := r.task.Commits(plumbing.NewHash(oldSha), limit)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			`name`: r.config.Name,
+			`url`:  r.config.Url,
+			`path`: r.config.Path,
+		}).Warn(`unable to read new commits`)
+	}
+	for _, commit := range commits {
+		payload.Commits = append(payload.Commits, notifyCommit{
+			Sha:     commit.Hash.String(),
+			Message: strings.TrimSpace(commit.Message),
+			Author:  commit.Author.String(),
+			Time:    commit.Author.When,
+		})
+	}
+	r.notify(payload)
+}
+
+func (r *taskRunner) notifyFailed(err error) {
+	r.notify(&notifyPayload{
+		Event:    NotifyEventFailed,
+		Error:    err.Error(),
+		Failures: r.failures,
+	})
+}
+
+func (r *taskRunner) updateHead() {
+	head, err := r.task.Head()
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			`name`: r.config.Name,
+			`url`:  r.config.Url,
+			`path`: r.config.Path,
+		}).Warn(`unable to resolve HEAD`)
+		return
+	}
+	sha := head.Hash().String()
+	ref := head.Name().String()
+
+	oldSha, oldRef := r.status.head()
+	if oldSha != sha || oldRef != ref {
+		if len(oldSha) > 0 {
+			commitInfo.DeleteLabelValues(r.config.Name, oldSha, oldRef)
+		}
+		commitInfo.WithLabelValues(r.config.Name, sha, ref).Set(1)
+	}
+
+	r.status.setHead(sha, ref)
+}
+
+// RunOnce clones/attaches the repo and syncs it once, a fresh clone is not pulled again.
+func (r *taskRunner) RunOnce() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopped {
+		return ErrTaskIsStopped
+	}
+
+	r.status.started()
+	err := r.sync()
+	if err == nil && r.existing {
+		err = r.sync()
+	}
+	if err != nil {
+		r.failures++
+		r.notifyFailed(err)
+	}
+	r.status.finished(err, r.failures)
+	return err
+}
+
+// Trigger runs the sync immediately through the scheduler.
+// If a run is already pending, its call is returned. An in-flight run may have fetched the remote before the trigger,
+// so exactly one follow-up run is queued after it instead.
+func (r *taskRunner) Trigger() *runCall {
+	r.callMu.Lock()
+	if r.call != nil && !r.call.started {
+		call := r.call
+		r.callMu.Unlock()
+		return call
+	}
+	if r.queued != nil {
+		call := r.queued
+		r.callMu.Unlock()
+		return call
+	}
+	call := &runCall{
+		done: make(chan struct{}),
+	}
+	if r.call == nil {
+		r.call = call
+	} else {
+		r.queued = call
+	}
+	r.callMu.Unlock()
+
+	log.WithFields(log.Fields{
+		`name`: r.config.Name,
+		`url`:  r.config.Url,
+		`path`: r.config.Path,
+	}).Info(`sync has been triggered manually`)
+
+	err := scheduler.Execute(func() error {
+		_, err := r.run(call)
+		return err
+	})
+	if err != nil {
+		r.finishCall(call, err)
+	}
+	return call
+}
+
+func (r *taskRunner) startCall() *runCall {
+	r.callMu.Lock()
+	defer r.callMu.Unlock()
+	if r.call == nil {
+		r.call = &runCall{
+			done: make(chan struct{}),
+		}
+	}
+	r.call.started = true
+	return r.call
+}
+
+func (r *taskRunner) finishCall(call *runCall, err error) {
+	r.callMu.Lock()
+	defer r.callMu.Unlock()
+	call.err = err
+	close(call.done)
+	switch call {
+	case r.call:
+		// the follow-up becomes pending, so it is picked up by the next run
+		r.call, r.queued = r.queued, nil
+	case r.queued:
+		r.queued = nil
+	}
+}
+
+// Run syncs the repo and returns the delay before the next run.
+// An error is returned only if the app has to exit.
+func (r *taskRunner) Run() (time.Duration, error) {
+	return r.run(nil)
+}
+
+// run syncs the repo, trigger is the call of a manual run and it is nil for scheduled runs.
+func (r *taskRunner) run(trigger *runCall) (time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// a scheduled run has picked up the call while the manual run was waiting for the lock
+	if trigger != nil && trigger.finished() {
+		return 0, nil
+	}
+	triggered := trigger != nil
+	call := r.startCall()
+
+	if r.stopped {
+		r.finishCall(call, ErrTaskIsStopped)
+		return r.config.Interval(), nil
+	}
+
+	r.status.started()
+	err := r.sync()
+	r.finishCall(call, err)
+	if err == nil {
+		if r.failures > 0 {
+			log.WithFields(log.Fields{
+				`name`:     r.config.Name,
+				`url`:      r.config.Url,
+				`path`:     r.config.Path,
+				`failures`: r.failures,
+			}).Info(`task has been recovered`)
+			r.notify(&notifyPayload{
+				Event:    NotifyEventRecovered,
+				Failures: r.failures,
+			})
+		}
+		r.failures = 0
+		r.status.finished(nil, r.failures)
+		return r.next(r.config.Interval(), triggered), nil
+	}
+
+	r.failures++
+	r.status.finished(err, r.failures)
+	limit := r.config.FailureLimit()
+	if r.failures == 1 {
+		r.notifyFailed(err)
+	}
+
+	logger := log.WithError(err).WithFields(log.Fields{
+		`name`:         r.config.Name,
+		`url`:          r.config.Url,
+		`path`:         r.config.Path,
+		`failures`:     r.failures,
+		`max_failures`: limit,
+		`on_error`:     r.config.OnError,
+	})
+
+	if limit == 0 || r.failures < limit {
+		delay := r.next(r.config.RetryDelay(r.failures), triggered)
+		logger.WithFields(log.Fields{
+			`retry_in`: delay,
+		}).Error(`task has failed`)
+		return delay, nil
+	}
+
+	r.stopped = true
+	r.status.setStopped()
+
+	if r.config.OnError == OnErrorExit {
+		logger.Error(`task has failed, stop the app`)
+		return 0, fmt.Errorf(`task %s has failed %d times in a row: %v`, r.config.Name, r.failures, err)
+	}
+
+	logger.Error(`task has failed too many times in a row, stop syncing it`)
+	if r.job != nil {
+		r.job.Cancel()
+	}
+	return r.config.Interval(), nil
+}
+
+// next records the time of the next run, cron tasks ignore the delay.
+// Manual runs do not change the schedule, so the time is not recorded for them.
+func (r *taskRunner) next(delay time.Duration, triggered bool) time.Duration {
+	now := time.Now()
+	if len(r.config.Schedule) > 0 {
+		if nextRun, err := NextCronTime(r.config.Schedule, now); err == nil {
+			delay = nextRun.Sub(now)
+		}
+	}
+	if !triggered {
+		r.status.scheduled(now.Add(delay))
+	}
+	return delay
+}
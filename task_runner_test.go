@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	. "registry.fozzy.lan/palefat/git-sync-go/scheduler"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowTask is a task whose pulls block until they are released, HEAD is the number of the last pull.
+type slowTask struct {
+	mu      sync.Mutex
+	pulls   int
+	started chan int
+	release chan struct{}
+}
+
+func newSlowTask() *slowTask {
+	return &slowTask{
+		started: make(chan int, 10),
+		release: make(chan struct{}),
+	}
+}
+
+func (t *slowTask) CloneOrAttach() (bool, error) {
+	return true, nil
+}
+
+func (t *slowTask) Pull() error {
+	t.mu.Lock()
+	t.pulls++
+	pull := t.pulls
+	t.mu.Unlock()
+	t.started <- pull
+	<-t.release
+	return nil
+}
+
+func (t *slowTask) Head() (*plumbing.Reference, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return plumbing.NewHashReference(plumbing.HEAD, pullHash(t.pulls)), nil
+}
+
+func (t *slowTask) Commits(plumbing.Hash, int) ([]*object.Commit, error) {
+	return nil, nil
+}
+
+func pullHash(pull int) plumbing.Hash {
+	return plumbing.NewHash(fmt.Sprintf(`%040d`, pull))
+}
+
+func waitPull(t *testing.T, task *slowTask) int {
+	t.Helper()
+	select {
+	case pull := <-task.started:
+		return pull
+	case <-time.After(5 * time.Second):
+		t.Fatal(`pull has not been started`)
+		return 0
+	}
+}
+
+func waitCall(t *testing.T, call *runCall) {
+	t.Helper()
+	select {
+	case <-call.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal(`call has not been finished`)
+	}
+}
+
+func newSlowRunner(t *testing.T) (*taskRunner, *slowTask) {
+	previous := scheduler
+	scheduler = NewAppScheduler(make(chan error, 10))
+	t.Cleanup(func() {
+		_ = scheduler.Close()
+		scheduler = previous
+	})
+	task := newSlowTask()
+	return &taskRunner{
+		config:   &TaskConfig{Name: `slow`, IntervalSeconds: 60},
+		task:     task,
+		attached: true,
+	}, task
+}
+
+func TestTaskRunner_TriggerDuringInFlightRun(t *testing.T) {
+	runner, task := newSlowRunner(t)
+
+	// a scheduled run has fetched the remote before the push
+	go func() { _, _ = runner.Run() }()
+	if pull := waitPull(t, task); pull != 1 {
+		t.Fatalf(`pull 1 is expected, got %d`, pull)
+	}
+
+	call := runner.Trigger()
+	if again := runner.Trigger(); again != call {
+		t.Error(`triggers during the in-flight run have to share one follow-up run`)
+	}
+
+	task.release <- struct{}{}
+	if call.finished() {
+		t.Fatal(`trigger is finished by the in-flight run`)
+	}
+
+	if pull := waitPull(t, task); pull != 2 {
+		t.Fatalf(`follow-up pull 2 is expected, got %d`, pull)
+	}
+	// the follow-up run is in flight now, so the next trigger gets its own follow-up
+	next := runner.Trigger()
+	if next == call {
+		t.Error(`trigger after the start of the follow-up run has to queue another run`)
+	}
+	task.release <- struct{}{}
+	waitCall(t, call)
+
+	if err := call.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if sha, _ := runner.status.head(); sha != pullHash(2).String() {
+		t.Errorf(`HEAD of the follow-up run %s is expected, got %s`, pullHash(2), sha)
+	}
+
+	if pull := waitPull(t, task); pull != 3 {
+		t.Fatalf(`follow-up pull 3 is expected, got %d`, pull)
+	}
+	task.release <- struct{}{}
+	waitCall(t, next)
+}
+
+func TestTaskRunner_TriggerPendingRun(t *testing.T) {
+	runner, task := newSlowRunner(t)
+
+	call := runner.Trigger()
+	if pull := waitPull(t, task); pull != 1 {
+		t.Fatalf(`pull 1 is expected, got %d`, pull)
+	}
+	task.release <- struct{}{}
+	waitCall(t, call)
+
+	select {
+	case pull := <-task.started:
+		t.Errorf(`unexpected pull %d`, pull)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// onceTask is a task that counts its clones and pulls, existing is reported by CloneOrAttach.
+type onceTask struct {
+	existing bool
+	clones   int
+	pulls    int
+}
+
+func (t *onceTask) CloneOrAttach() (bool, error) {
+	t.clones++
+	return t.existing, nil
+}
+
+func (t *onceTask) Pull() error {
+	t.pulls++
+	return nil
+}
+
+func (t *onceTask) Head() (*plumbing.Reference, error) {
+	return plumbing.NewHashReference(plumbing.HEAD, pullHash(t.pulls)), nil
+}
+
+func (t *onceTask) Commits(plumbing.Hash, int) ([]*object.Commit, error) {
+	return nil, nil
+}
+
+func TestTaskRunner_RunOnce(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing bool
+		pulls    int
+	}{
+		{
+			name:     `fresh clone is not pulled`,
+			existing: false,
+			pulls:    0,
+		},
+		{
+			name:     `existing repo is pulled`,
+			existing: true,
+			pulls:    1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			task := &onceTask{existing: test.existing}
+			runner := &taskRunner{
+				config: &TaskConfig{Name: `once`, RunOnce: true},
+				task:   task,
+			}
+			if err := runner.RunOnce(); err != nil {
+				t.Fatal(err)
+			}
+			if task.clones != 1 || task.pulls != test.pulls {
+				t.Errorf(`1 clone and %d pull(s) are expected, got %d clone(s) and %d pull(s)`, test.pulls, task.clones, task.pulls)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// taskStatus is the runtime state of the task, it is read by the http server.
+type taskStatus struct {
+	mu          sync.RWMutex
+	ready       bool
+	running     bool
+	stopped     bool
+	lastAttempt time.Time
+	lastSuccess time.Time
+	lastError   error
+	failures    int
+	nextRun     time.Time
+	headSha     string
+	headRef     string
+	lastHookRun time.Time
+	hookError   error
+}
+
+// taskStatusView is the json representation of the task status.
+type taskStatusView struct {
+	Name                string      `json:"name"`
+	Config              *TaskConfig `json:"config"`
+	Ready               bool        `json:"ready"`
+	Running             bool        `json:"running"`
+	Stopped             bool        `json:"stopped"`
+	HeadSha             string      `json:"headSha,omitempty"`
+	HeadRef             string      `json:"headRef,omitempty"`
+	LastAttempt         *time.Time  `json:"lastAttempt,omitempty"`
+	LastSuccess         *time.Time  `json:"lastSuccess,omitempty"`
+	LastError           string      `json:"lastError,omitempty"`
+	ConsecutiveFailures int         `json:"consecutiveFailures"`
+	NextRun             *time.Time  `json:"nextRun,omitempty"`
+	LastHookRun         *time.Time  `json:"lastHookRun,omitempty"`
+	LastHookError       string      `json:"lastHookError,omitempty"`
+}
+
+func (s *taskStatus) setReady() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ready = true
+}
+
+func (s *taskStatus) started() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = true
+	s.lastAttempt = time.Now()
+}
+
+func (s *taskStatus) finished(err error, failures int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = false
+	s.lastError = err
+	s.failures = failures
+	if err == nil {
+		s.lastSuccess = time.Now()
+	}
+}
+
+func (s *taskStatus) setHead(sha string, ref string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.headSha = sha
+	s.headRef = ref
+}
+
+func (s *taskStatus) hookFinished(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastHookRun = time.Now()
+	s.hookError = err
+}
+
+func (s *taskStatus) head() (string, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.headSha, s.headRef
+}
+
+func (s *taskStatus) scheduled(nextRun time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextRun = nextRun
+}
+
+func (s *taskStatus) setStopped() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	s.nextRun = time.Time{}
+}
+
+func (s *taskStatus) isReady() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ready
+}
+
+// isStalled returns true if the next run is overdue by more than the timeout.
+func (s *taskStatus) isStalled(now time.Time, timeout time.Duration) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.stopped || s.nextRun.IsZero() {
+		return false
+	}
+	return now.After(s.nextRun.Add(timeout))
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (s *taskStatus) view(config *TaskConfig) *taskStatusView {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	maskedConfig := *config
+	maskedConfig.Url = config.RedactedUrl()
+
+	view := &taskStatusView{
+		Name:                config.Name,
+		Config:              &maskedConfig,
+		Ready:               s.ready,
+		Running:             s.running,
+		Stopped:             s.stopped,
+		HeadSha:             s.headSha,
+		HeadRef:             s.headRef,
+		LastAttempt:         optionalTime(s.lastAttempt),
+		LastSuccess:         optionalTime(s.lastSuccess),
+		ConsecutiveFailures: s.failures,
+		NextRun:             optionalTime(s.nextRun),
+		LastHookRun:         optionalTime(s.lastHookRun),
+	}
+	if s.lastError != nil {
+		view.LastError = s.lastError.Error()
+	}
+	if s.hookError != nil {
+		view.LastHookError = s.hookError.Error()
+	}
+	return view
+}
+
+// taskRegistry keeps runners of all configured tasks.
+type taskRegistry struct {
+	mu      sync.RWMutex
+	runners map[string]*taskRunner
+}
+
+var appTasks = &taskRegistry{
+	runners: map[string]*taskRunner{},
+}
+
+func (r *taskRegistry) add(runner *taskRunner) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runners[runner.config.Name] = runner
+}
+
+func (r *taskRegistry) remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.runners, name)
+}
+
+func (r *taskRegistry) get(name string) (*taskRunner, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	runner, found := r.runners[name]
+	return runner, found
+}
+
+// list returns runners sorted by the task name.
+func (r *taskRegistry) list() []*taskRunner {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	runners := make([]*taskRunner, 0, len(r.runners))
+	for _, runner := range r.runners {
+		runners = append(runners, runner)
+	}
+	sort.Slice(runners, func(i, j int) bool {
+		return runners[i].config.Name < runners[j].config.Name
+	})
+	return runners
+}
+
+// notReady returns names of tasks that are required for readiness and have not been cloned yet.
+func (r *taskRegistry) notReady() []string {
+	names := make([]string, 0)
+	for _, runner := range r.list() {
+		if runner.config.IsReadinessGate() && !runner.status.isReady() {
+			names = append(names, runner.config.Name)
+		}
+	}
+	return names
+}
+
+// stalled returns names of tasks whose next run is overdue by more than the timeout.
+func (r *taskRegistry) stalled(timeout time.Duration) []string {
+	now := time.Now()
+	names := make([]string, 0)
+	for _, runner := range r.list() {
+		if runner.status.isStalled(now, timeout) {
+			names = append(names, runner.config.Name)
+		}
+	}
+	return names
+}
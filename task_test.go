@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"os"
+	"path/filepath"
+	. "registry.fozzy.lan/palefat/git-sync-go/errors"
+	"testing"
+	"time"
+)
+
+func newGpgEntity(t *testing.T, name string) (*openpgp.Entity, string) {
+	t.Helper()
+	entity, err := openpgp.NewEntity(name, ``, name+`@example.com`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var public bytes.Buffer
+	writer, err := armor.Encode(&public, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.Serialize(writer); err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return entity, public.String()
+}
+
+// newOriginRepo creates a repo with a single commit of README.md signed by the key.
+func newOriginRepo(t *testing.T, signKey *openpgp.Entity) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), `origin`)
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, `README.md`), []byte("release\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = worktree.Add(`README.md`); err != nil {
+		t.Fatal(err)
+	}
+	signature := &object.Signature{Name: `release`, Email: `release@example.com`, When: time.Now()}
+	_, err = worktree.Commit(`release`, &git.CommitOptions{Author: signature, Committer: signature, SignKey: signKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestGitSyncTask_CloneOrAttachVerifyRejectedThenAccepted(t *testing.T) {
+	release, releaseKey := newGpgEntity(t, `release`)
+	_, otherKey := newGpgEntity(t, `other`)
+	origin := newOriginRepo(t, release)
+
+	tests := []struct {
+		name    string
+		restart bool
+	}{
+		{name: `same task`},
+		{name: `restarted task`, restart: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			keyFile := filepath.Join(dir, `keys.asc`)
+			if err := os.WriteFile(keyFile, []byte(otherKey), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config := &TaskConfig{
+				Name:         `release`,
+				Url:          origin,
+				Path:         filepath.Join(dir, `repo`),
+				LocalChanges: LocalChangesFail,
+				OnForcePush:  OnForcePushReset,
+				Verify:       &Verify{Gpg: &Secret{ValueFrom: &SecretValueFrom{File: keyFile}}},
+			}
+			config.Reference.Branch = `master`
+			readme := filepath.Join(config.Path, `README.md`)
+
+			task, err := NewGitSyncTask(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var signatureErr *SignatureError
+			if _, err = task.CloneOrAttach(); !errors.As(err, &signatureErr) {
+				t.Fatalf(`signature error is expected, got %v`, err)
+			}
+			if _, err = os.Stat(readme); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf(`rejected revision is checked out: %v`, err)
+			}
+
+			// the keys are rotated, so the same commit is verified now
+			if err = os.WriteFile(keyFile, []byte(releaseKey), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if test.restart {
+				if task, err = NewGitSyncTask(config); err != nil {
+					t.Fatal(err)
+				}
+			}
+			attached, err := task.CloneOrAttach()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !attached {
+				t.Error(`the cloned repo is expected to be attached`)
+			}
+			content, err := os.ReadFile(readme)
+			if err != nil {
+				t.Fatalf(`verified revision is not checked out: %v`, err)
+			}
+			if string(content) != "release\n" {
+				t.Errorf(`unexpected content %q`, content)
+			}
+			if err = task.Pull(); err != nil {
+				t.Errorf(`pull of the checked out repo has failed: %v`, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli/v2"
+	yamlv2 "gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
+	"os"
+	"regexp"
+	"registry.fozzy.lan/palefat/git-sync-go/schema"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed tasks.schema.json
+var tasksSchema []byte
+
+var validateCommand = &cli.Command{
+	Name:      `validate`,
+	Usage:     `Validate the config file and report all problems`,
+	UsageText: `git-sync validate --config tasks.yaml`,
+	Flags: []cli.Flag{
+		&validateConfigFileFlag,
+	},
+	Action: validateAction,
+}
+
+// configProblem is a problem of the config file, Line is 0 if it is unknown.
+// Task is like `task name` or `tasks[1]` if the task has no name.
+type configProblem struct {
+	Line    int
+	Task    string
+	Message string
+}
+
+func (p configProblem) String() string {
+	var sb strings.Builder
+	if p.Line > 0 {
+		sb.WriteString(fmt.Sprintf(`line %d: `, p.Line))
+	}
+	if len(p.Task) > 0 {
+		sb.WriteString(p.Task + `: `)
+	}
+	sb.WriteString(p.Message)
+	return sb.String()
+}
+
+func validateAction(c *cli.Context) error {
+	path := c.String(validateConfigFileFlag.Name)
+	if len(path) == 0 {
+		return cli.Exit(fmt.Sprintf(`flag "%s" is required`, validateConfigFileFlag.Name), 2)
+	}
+
+	problems, err := validateConfigFile(path)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf(`%s: %v`, path, err), 2)
+	}
+
+	out := c.App.Writer
+	if len(problems) == 0 {
+		_, _ = fmt.Fprintf(out, "%s: config is valid\n", path)
+		return nil
+	}
+	for _, problem := range problems {
+		_, _ = fmt.Fprintf(out, "%s: %s\n", path, problem)
+	}
+	return cli.Exit(fmt.Sprintf(`%s: %d problem(s) found`, path, len(problems)), 1)
+}
+
+// validateConfigFile checks the config against the schema and the rules of the app. The environment of the app
+// (secrets, keys and the git cli) is not checked, so configs can be validated where they are not deployed.
+// Problems of the app rules are not reported for task fields with schema problems to avoid duplicated problems.
+func validateConfigFile(path string) ([]configProblem, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	document := &yaml.Node{}
+	if err = yaml.Unmarshal(content, document); err != nil {
+		return []configProblem{yamlProblem(err.Error())}, nil
+	}
+	if document.Kind == 0 {
+		return []configProblem{{Message: `config file is empty`}}, nil
+	}
+
+	configSchema, err := schema.Parse(tasksSchema)
+	if err != nil {
+		return nil, fmt.Errorf(`config schema is not valid: %v`, err)
+	}
+
+	tasks := taskNodes(document)
+	invalidFields := map[int][]string{}
+	// invalidGlobalFields are fields outside of tasks with schema problems
+	var invalidGlobalFields []string
+
+	var problems []configProblem
+	for _, schemaErr := range configSchema.Validate(document) {
+		problem := configProblem{
+			Line:    schemaErr.Line,
+			Message: schemaErr.Message,
+		}
+		if index, rest, ok := taskIndex(schemaErr.Path); ok && index < len(tasks) {
+			invalidFields[index] = append(invalidFields[index], joinField(rest, schemaErr.Property))
+			problem.Task = taskLabel(tasks[index], index)
+			if len(rest) > 0 {
+				problem.Message = rest + `: ` + problem.Message
+			}
+		} else {
+			invalidGlobalFields = append(invalidGlobalFields, joinField(schemaErr.Path, schemaErr.Property))
+			if len(schemaErr.Path) > 0 {
+				problem.Message = schemaErr.Path + `: ` + problem.Message
+			}
+		}
+		problems = append(problems, problem)
+	}
+
+	// type errors do not stop decoding, so the rest of the config is still validated
+	config := &Config{}
+	if err = yamlv2.Unmarshal(content, config); err != nil {
+		var typeErr *yamlv2.TypeError
+		if !errors.As(err, &typeErr) {
+			return append(problems, yamlProblem(err.Error())), nil
+		}
+		// the schema reports type mismatches with more details
+		if len(problems) == 0 {
+			for _, message := range typeErr.Errors {
+				problems = append(problems, yamlProblem(message))
+			}
+		}
+	}
+
+	for _, err = range config.ValidateAll() {
+		var taskErr *TaskConfigError
+		if !errors.As(err, &taskErr) {
+			problem := configProblem{
+				Message: err.Error(),
+			}
+			var fieldErr *ConfigFieldError
+			if errors.As(err, &fieldErr) {
+				if overlapsAny(fieldErr.Field, invalidGlobalFields) {
+					continue
+				}
+				problem.Line = fieldLine(rootMapping(document), fieldErr.Field)
+			}
+			problems = append(problems, problem)
+			continue
+		}
+		field := ``
+		var fieldErr *TaskFieldError
+		if errors.As(taskErr.Err, &fieldErr) {
+			field = fieldErr.Field
+		}
+		if overlapsAny(field, invalidFields[taskErr.Index]) {
+			continue
+		}
+		problem := configProblem{
+			Message: taskErr.Err.Error(),
+		}
+		if taskErr.Index < len(tasks) {
+			problem.Line = fieldLine(tasks[taskErr.Index], field)
+			problem.Task = taskLabel(tasks[taskErr.Index], taskErr.Index)
+		}
+		problems = append(problems, problem)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+	return problems, nil
+}
+
+var yamlLinePattern = regexp.MustCompile(`line (\d+): `)
+
+// yamlProblem extracts the line number from YAML parser messages.
+func yamlProblem(message string) configProblem {
+	message = strings.TrimPrefix(message, `yaml: `)
+	match := yamlLinePattern.FindStringSubmatchIndex(message)
+	if match == nil {
+		return configProblem{Message: message}
+	}
+	line, _ := strconv.Atoi(message[match[2]:match[3]])
+	return configProblem{
+		Line:    line,
+		Message: message[:match[0]] + message[match[1]:],
+	}
+}
+
+var taskPathPattern = regexp.MustCompile(`^tasks\[(\d+)](?:\.(.+))?$`)
+
+// taskIndex splits a schema path like `tasks[1].auth.ssh` into the task index and the rest of the path.
+func taskIndex(path string) (int, string, bool) {
+	match := taskPathPattern.FindStringSubmatch(path)
+	if match == nil {
+		return 0, ``, false
+	}
+	index, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, ``, false
+	}
+	return index, match[2], true
+}
+
+func joinField(path string, property string) string {
+	if len(path) == 0 || len(property) == 0 {
+		return path + property
+	}
+	return path + `.` + property
+}
+
+// overlapsAny reports if the field is one of the fields, or it is inside of one of them, or it contains one of them.
+func overlapsAny(field string, fields []string) bool {
+	for _, other := range fields {
+		if field == other || isSubField(field, other) || isSubField(other, field) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSubField(field string, parent string) bool {
+	return len(parent) == 0 || strings.HasPrefix(field, parent+`.`) || strings.HasPrefix(field, parent+`[`)
+}
+
+var fieldPartPattern = regexp.MustCompile(`([^.\[\]]+)|\[(\d+)]`)
+
+// fieldLine returns the line of the field of the node (a task or the root mapping) like `auth.ssh` or `sparse[1]`,
+// the line of the closest present parent is returned for missing fields.
+func fieldLine(parent *yaml.Node, field string) int {
+	line := parent.Line
+	node := parent
+	for _, part := range fieldPartPattern.FindAllStringSubmatch(field, -1) {
+		if len(part[2]) > 0 {
+			index, _ := strconv.Atoi(part[2])
+			if node.Kind != yaml.SequenceNode || index >= len(node.Content) {
+				break
+			}
+			node = node.Content[index]
+			line = node.Line
+			continue
+		}
+		key, value := mappingValue(node, part[1])
+		if key == nil {
+			break
+		}
+		node = value
+		line = key.Line
+	}
+	return line
+}
+
+func rootMapping(document *yaml.Node) *yaml.Node {
+	if document.Kind == yaml.DocumentNode && len(document.Content) > 0 {
+		return document.Content[0]
+	}
+	return document
+}
+
+func mappingValue(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+func taskNodes(document *yaml.Node) []*yaml.Node {
+	_, tasks := mappingValue(rootMapping(document), `tasks`)
+	if tasks == nil || tasks.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return tasks.Content
+}
+
+func taskLabel(task *yaml.Node, index int) string {
+	if _, name := mappingValue(task, `name`); name != nil && name.Kind == yaml.ScalarNode && len(name.Value) > 0 {
+		return `task ` + name.Value
+	}
+	return fmt.Sprintf(`tasks[%d]`, index)
+}
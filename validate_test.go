@@ -0,0 +1,254 @@
+package main
+
+import (
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), `tasks.yaml`)
+	if err := os.WriteFile(path, []byte(strings.TrimLeft(content, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidateConfigFile_Environment(t *testing.T) {
+	path := writeConfigFile(t, `
+webhooks:
+  github:
+    valueFrom:
+      env: GIT_SYNC_TEST_MISSING_WEBHOOK_SECRET
+tasks:
+  - name: api
+    url: https://example.com/monorepo.git
+    path: /tmp/git-sync-test/api
+    sparse: [ services/api ]
+    auth:
+      basicToken:
+        valueFrom:
+          env: GIT_SYNC_TEST_MISSING_TOKEN
+    verify:
+      gpg:
+        valueFrom:
+          file: /git-sync-test/missing/keys.asc
+    notify:
+      - url: https://example.com/events
+        secret:
+          valueFrom:
+            file: /git-sync-test/missing/hmac
+`)
+
+	problems, err := validateConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Errorf(`the environment is not expected to be checked, got %v`, problems)
+	}
+
+	if _, _, err = loadConfig(path); err == nil || !strings.Contains(err.Error(), `GIT_SYNC_TEST_MISSING_WEBHOOK_SECRET`) {
+		t.Errorf(`the app is expected to check the environment, got %v`, err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{}
+	if err = yaml.Unmarshal(content, config); err != nil {
+		t.Fatal(err)
+	}
+	if errs := config.ValidateAll(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	errs := config.CheckAll()
+	for _, expected := range []string{
+		`GIT_SYNC_TEST_MISSING_TOKEN`,
+		`/git-sync-test/missing/keys.asc`,
+		`/git-sync-test/missing/hmac`,
+	} {
+		found := false
+		for _, err := range errs {
+			found = found || strings.Contains(err.Error(), expected)
+		}
+		if !found {
+			t.Errorf(`problem of %s is expected, got %v`, expected, errs)
+		}
+	}
+}
+
+func TestValidateConfigFile_GlobalFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		problems []string
+	}{
+		{
+			name: `notify problem is reported at its line`,
+			config: `
+notify:
+  - url: https://example.com/events
+  - url: http://
+tasks:
+  - name: a
+    url: https://example.com/a.git
+    path: /tmp/git-sync-test/a
+`,
+			problems: []string{
+				`line 3: notify[1] -> url -> must be an http(s) url`,
+			},
+		},
+		{
+			name: `notify problem flagged by the schema is reported once`,
+			config: `
+tasks:
+  - name: a
+    url: https://example.com/a.git
+    path: /tmp/git-sync-test/a
+notify:
+  - url: ftp://example.com/events
+`,
+			problems: []string{
+				`line 6: notify[0].url: does not match pattern '^https?://'`,
+			},
+		},
+		{
+			name: `webhooks problem is reported at the provider line`,
+			config: `
+tasks:
+  - name: a
+    url: https://example.com/a.git
+    path: /tmp/git-sync-test/a
+webhooks:
+  gitea:
+    value: secret
+    valueFrom:
+      env: GIT_SYNC_TEST_WEBHOOK_SECRET
+`,
+			problems: []string{
+				`line 6: webhooks -> gitea -> secret -> value end valueFrom configs cannot be set simultaneously`,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems, err := validateConfigFile(writeConfigFile(t, test.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			messages := make([]string, 0, len(problems))
+			for _, problem := range problems {
+				messages = append(messages, problem.String())
+			}
+			if strings.Join(messages, "\n") != strings.Join(test.problems, "\n") {
+				t.Errorf("problems:\n%s\nexpected:\n%s", strings.Join(messages, "\n"), strings.Join(test.problems, "\n"))
+			}
+		})
+	}
+}
+
+func TestValidateConfigFile_Conflicts(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		problems []string
+	}{
+		{
+			name: `path contains the publish link of another task`,
+			config: `
+tasks:
+  - name: a
+    url: https://example.com/a.git
+    path: /tmp/git-sync-test/a
+    publish:
+      link: /tmp/git-sync-test/b/current
+      worktrees: /tmp/git-sync-test/worktrees/a
+  - name: b
+    url: https://example.com/b.git
+    path: /tmp/git-sync-test/b
+`,
+			problems: []string{
+				`line 10: task b: task path overlaps with another task: /tmp/git-sync-test/b contains publish.link /tmp/git-sync-test/b/current of task a`,
+			},
+		},
+		{
+			name: `publish worktrees is the path of another task`,
+			config: `
+tasks:
+  - name: a
+    url: https://example.com/a.git
+    path: /tmp/git-sync-test/a
+  - name: b
+    url: https://example.com/b.git
+    path: /tmp/git-sync-test/b
+    publish:
+      link: /tmp/git-sync-test/current
+      worktrees: /tmp/git-sync-test/a
+`,
+			problems: []string{
+				`line 10: task b: task path is not unique: /tmp/git-sync-test/a is the same location as /tmp/git-sync-test/a of task a`,
+			},
+		},
+		{
+			name: `publish dirs of tasks are nested`,
+			config: `
+tasks:
+  - name: a
+    url: https://example.com/a.git
+    path: /tmp/git-sync-test/a
+    publish:
+      link: /tmp/git-sync-test/current-a
+      worktrees: /tmp/git-sync-test/worktrees
+  - name: b
+    url: https://example.com/b.git
+    path: /tmp/git-sync-test/b
+    publish:
+      link: /tmp/git-sync-test/current-b
+      worktrees: /tmp/git-sync-test/worktrees/b
+`,
+			problems: []string{
+				`line 13: task b: task path overlaps with another task: /tmp/git-sync-test/worktrees/b is inside publish.worktrees /tmp/git-sync-test/worktrees of task a`,
+			},
+		},
+		{
+			name: `same publish link`,
+			config: `
+tasks:
+  - name: a
+    url: https://example.com/a.git
+    path: /tmp/git-sync-test/a
+    publish:
+      link: /tmp/git-sync-test/current
+  - name: b
+    url: https://example.com/b.git
+    path: /tmp/git-sync-test/b
+    publish:
+      link: /tmp/git-sync-test/current
+`,
+			problems: []string{
+				`line 10: task b: publish link or worktrees dir is not unique: /tmp/git-sync-test/.worktrees/current is used by task a`,
+				`line 11: task b: publish link or worktrees dir is not unique: /tmp/git-sync-test/current is used by task a`,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems, err := validateConfigFile(writeConfigFile(t, test.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			messages := make([]string, 0, len(problems))
+			for _, problem := range problems {
+				messages = append(messages, problem.String())
+			}
+			if strings.Join(messages, "\n") != strings.Join(test.problems, "\n") {
+				t.Errorf("problems:\n%s\nexpected:\n%s", strings.Join(messages, "\n"), strings.Join(test.problems, "\n"))
+			}
+		})
+	}
+}
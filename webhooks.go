@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	webhooksPath        = `/webhooks/`
+	maxWebhookBodyBytes = 10 << 20
+)
+
+// appWebhooks is the webhooks config, webhooks are disabled if it is not set.
+// It is replaced when the config file is reloaded.
+var appWebhooks atomic.Pointer[Webhooks]
+
+// pushEvent contains fields of push payloads of GitHub, GitLab and Gitea that are required to find tasks.
+type pushEvent struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		CloneUrl   string `json:"clone_url"`
+		SshUrl     string `json:"ssh_url"`
+		HtmlUrl    string `json:"html_url"`
+		GitHttpUrl string `json:"git_http_url"`
+		GitSshUrl  string `json:"git_ssh_url"`
+	} `json:"repository"`
+	Project struct {
+		GitHttpUrl string `json:"git_http_url"`
+		GitSshUrl  string `json:"git_ssh_url"`
+		WebUrl     string `json:"web_url"`
+	} `json:"project"`
+}
+
+func (e *pushEvent) repoUrls() []string {
+	urls := []string{
+		e.Repository.CloneUrl,
+		e.Repository.SshUrl,
+		e.Repository.HtmlUrl,
+		e.Repository.GitHttpUrl,
+		e.Repository.GitSshUrl,
+		e.Project.GitHttpUrl,
+		e.Project.GitSshUrl,
+		e.Project.WebUrl,
+	}
+	result := make([]string, 0, len(urls))
+	for _, u := range urls {
+		if len(u) > 0 {
+			result = append(result, u)
+		}
+	}
+	return result
+}
+
+// webhookProvider verifies the request and tells if it is a push event.
+type webhookProvider struct {
+	secret func(*Webhooks) *Secret
+	verify func(r *http.Request, body []byte, secret string) bool
+	isPush func(r *http.Request) bool
+}
+
+var webhookProviders = map[string]*webhookProvider{
+	`github`: {
+		secret: func(w *Webhooks) *Secret { return w.Github },
+		verify: func(r *http.Request, body []byte, secret string) bool {
+			signature := r.Header.Get(`X-Hub-Signature-256`)
+			if !strings.HasPrefix(signature, `sha256=`) {
+				return false
+			}
+			return verifyHmacSha256(body, secret, strings.TrimPrefix(signature, `sha256=`))
+		},
+		isPush: func(r *http.Request) bool {
+			return r.Header.Get(`X-GitHub-Event`) == `push`
+		},
+	},
+	`gitea`: {
+		secret: func(w *Webhooks) *Secret { return w.Gitea },
+		verify: func(r *http.Request, body []byte, secret string) bool {
+			return verifyHmacSha256(body, secret, r.Header.Get(`X-Gitea-Signature`))
+		},
+		isPush: func(r *http.Request) bool {
+			return r.Header.Get(`X-Gitea-Event`) == `push`
+		},
+	},
+	`gitlab`: {
+		secret: func(w *Webhooks) *Secret { return w.Gitlab },
+		verify: func(r *http.Request, body []byte, secret string) bool {
+			token := r.Header.Get(`X-Gitlab-Token`)
+			return len(token) > 0 && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+		},
+		isPush: func(r *http.Request) bool {
+			event := r.Header.Get(`X-Gitlab-Event`)
+			return event == `Push Hook` || event == `Tag Push Hook`
+		},
+	},
+}
+
+// verifyHmacSha256 tells if the signature is the hex HMAC SHA256 of the body, the empty secret never matches.
+func verifyHmacSha256(body []byte, secret string, signature string) bool {
+	if len(secret) == 0 {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func webhookHandler(w http.ResponseWriter, r *http.Request) {
+	providerName := strings.TrimPrefix(r.URL.Path, webhooksPath)
+	provider, found := webhookProviders[providerName]
+	webhooks := appWebhooks.Load()
+	if !found || webhooks == nil || provider.secret(webhooks) == nil {
+		writeJsonError(w, http.StatusNotFound, `webhook provider is not configured`)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJsonError(w, http.StatusMethodNotAllowed, `method is not allowed`)
+		return
+	}
+
+	secret, err := provider.secret(webhooks).GetValue()
+	if err == nil && len(secret) == 0 {
+		err = fmt.Errorf(`webhook secret is empty`)
+	}
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			`provider`: providerName,
+		}).Error(`unable to read webhook secret`)
+		writeJsonError(w, http.StatusInternalServerError, `webhook secret is not available`)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodyBytes))
+	if err != nil {
+		writeJsonError(w, http.StatusBadRequest, `unable to read body`)
+		return
+	}
+
+	if !provider.verify(r, body, secret) {
+		log.WithFields(log.Fields{
+			`provider`: providerName,
+			`remote`:   r.RemoteAddr,
+		}).Warn(`webhook signature is not valid`)
+		writeJsonError(w, http.StatusUnauthorized, `signature is not valid`)
+		return
+	}
+
+	if !provider.isPush(r) {
+		writeJson(w, http.StatusOK, map[string]interface{}{
+			`triggered`: []string{},
+		})
+		return
+	}
+
+	event := &pushEvent{}
+	if err = json.Unmarshal(body, event); err != nil {
+		writeJsonError(w, http.StatusBadRequest, fmt.Sprintf(`unable to parse payload: %v`, err))
+		return
+	}
+
+	triggered := make([]string, 0)
+	for _, runner := range appTasks.list() {
+		if runner.config.RunOnce || !runner.config.MatchesPushedRef(event.Ref) {
+			continue
+		}
+		for _, repoUrl := range event.repoUrls() {
+			if runner.config.MatchesRepo(repoUrl) {
+				runner.Trigger()
+				triggered = append(triggered, runner.config.Name)
+				break
+			}
+		}
+	}
+
+	log.WithFields(log.Fields{
+		`provider`:  providerName,
+		`ref`:       event.Ref,
+		`urls`:      event.repoUrls(),
+		`triggered`: triggered,
+	}).Info(`push webhook has been received`)
+
+	writeJson(w, http.StatusAccepted, map[string]interface{}{
+		`triggered`: triggered,
+	})
+}
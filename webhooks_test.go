@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testWebhookSecret = `s3cr3t`
+
+func sign(body string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyHmacSha256(t *testing.T) {
+	body := `{"ref":"refs/heads/main"}`
+	tests := []struct {
+		name      string
+		body      string
+		secret    string
+		signature string
+		valid     bool
+	}{
+		{name: `valid`, body: body, secret: testWebhookSecret, signature: sign(body, testWebhookSecret), valid: true},
+		{name: `upper case hex`, body: body, secret: testWebhookSecret, signature: strings.ToUpper(sign(body, testWebhookSecret)), valid: true},
+		{name: `wrong secret`, body: body, secret: testWebhookSecret, signature: sign(body, `other`)},
+		{name: `changed body`, body: body + ` `, secret: testWebhookSecret, signature: sign(body, testWebhookSecret)},
+		{name: `not hex`, body: body, secret: testWebhookSecret, signature: `not hex`},
+		{name: `truncated`, body: body, secret: testWebhookSecret, signature: sign(body, testWebhookSecret)[:32]},
+		{name: `empty signature`, body: body, secret: testWebhookSecret},
+		{name: `empty secret`, body: body, signature: sign(body, ``)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if valid := verifyHmacSha256([]byte(test.body), test.secret, test.signature); valid != test.valid {
+				t.Errorf(`verifyHmacSha256() = %v, want %v`, valid, test.valid)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	t.Setenv(`GIT_SYNC_TEST_EMPTY_SECRET`, ``)
+	secret := &Secret{Value: testWebhookSecret}
+	push := `{"ref":"refs/heads/main","repository":{"clone_url":"https://example.com/unknown.git"}}`
+
+	tests := []struct {
+		name     string
+		webhooks *Webhooks
+		method   string
+		provider string
+		body     string
+		headers  map[string]string
+		status   int
+	}{
+		{
+			name:     `webhooks are not configured`,
+			provider: `github`,
+			body:     push,
+			status:   http.StatusNotFound,
+		},
+		{
+			name:     `provider is not configured`,
+			webhooks: &Webhooks{Github: secret},
+			provider: `gitea`,
+			body:     push,
+			status:   http.StatusNotFound,
+		},
+		{
+			name:     `unknown provider`,
+			webhooks: &Webhooks{Github: secret},
+			provider: `bitbucket`,
+			body:     push,
+			status:   http.StatusNotFound,
+		},
+		{
+			name:     `method is not allowed`,
+			webhooks: &Webhooks{Github: secret},
+			method:   http.MethodGet,
+			provider: `github`,
+			status:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:     `github push`,
+			webhooks: &Webhooks{Github: secret},
+			provider: `github`,
+			body:     push,
+			headers: map[string]string{
+				`X-GitHub-Event`:      `push`,
+				`X-Hub-Signature-256`: `sha256=` + sign(push, testWebhookSecret),
+			},
+			status: http.StatusAccepted,
+		},
+		{
+			name:     `github ping`,
+			webhooks: &Webhooks{Github: secret},
+			provider: `github`,
+			body:     `{"zen":"hi"}`,
+			headers: map[string]string{
+				`X-GitHub-Event`:      `ping`,
+				`X-Hub-Signature-256`: `sha256=` + sign(`{"zen":"hi"}`, testWebhookSecret),
+			},
+			status: http.StatusOK,
+		},
+		{
+			name:     `github wrong signature`,
+			webhooks: &Webhooks{Github: secret},
+			provider: `github`,
+			body:     push,
+			headers: map[string]string{
+				`X-GitHub-Event`:      `push`,
+				`X-Hub-Signature-256`: `sha256=` + sign(push, `other`),
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:     `github signature without the sha256 prefix`,
+			webhooks: &Webhooks{Github: secret},
+			provider: `github`,
+			body:     push,
+			headers: map[string]string{
+				`X-GitHub-Event`:      `push`,
+				`X-Hub-Signature-256`: sign(push, testWebhookSecret),
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:     `github signature is missing`,
+			webhooks: &Webhooks{Github: secret},
+			provider: `github`,
+			body:     push,
+			headers:  map[string]string{`X-GitHub-Event`: `push`},
+			status:   http.StatusUnauthorized,
+		},
+		{
+			name:     `github malformed payload`,
+			webhooks: &Webhooks{Github: secret},
+			provider: `github`,
+			body:     `{`,
+			headers: map[string]string{
+				`X-GitHub-Event`:      `push`,
+				`X-Hub-Signature-256`: `sha256=` + sign(`{`, testWebhookSecret),
+			},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:     `empty secret`,
+			webhooks: &Webhooks{Github: &Secret{ValueFrom: &SecretValueFrom{Env: `GIT_SYNC_TEST_EMPTY_SECRET`}}},
+			provider: `github`,
+			body:     push,
+			headers: map[string]string{
+				`X-GitHub-Event`:      `push`,
+				`X-Hub-Signature-256`: `sha256=` + sign(push, ``),
+			},
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:     `gitea push`,
+			webhooks: &Webhooks{Gitea: secret},
+			provider: `gitea`,
+			body:     push,
+			headers: map[string]string{
+				`X-Gitea-Event`:     `push`,
+				`X-Gitea-Signature`: sign(push, testWebhookSecret),
+			},
+			status: http.StatusAccepted,
+		},
+		{
+			name:     `gitea wrong signature`,
+			webhooks: &Webhooks{Gitea: secret},
+			provider: `gitea`,
+			body:     push,
+			headers: map[string]string{
+				`X-Gitea-Event`:     `push`,
+				`X-Gitea-Signature`: sign(push, `other`),
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:     `gitlab tag push`,
+			webhooks: &Webhooks{Gitlab: secret},
+			provider: `gitlab`,
+			body:     push,
+			headers: map[string]string{
+				`X-Gitlab-Event`: `Tag Push Hook`,
+				`X-Gitlab-Token`: testWebhookSecret,
+			},
+			status: http.StatusAccepted,
+		},
+		{
+			name:     `gitlab wrong token`,
+			webhooks: &Webhooks{Gitlab: secret},
+			provider: `gitlab`,
+			body:     push,
+			headers: map[string]string{
+				`X-Gitlab-Event`: `Push Hook`,
+				`X-Gitlab-Token`: `other`,
+			},
+			status: http.StatusUnauthorized,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previous := appWebhooks.Swap(test.webhooks)
+			defer appWebhooks.Store(previous)
+
+			method := test.method
+			if len(method) == 0 {
+				method = http.MethodPost
+			}
+			request := httptest.NewRequest(method, webhooksPath+test.provider, strings.NewReader(test.body))
+			for name, value := range test.headers {
+				request.Header.Set(name, value)
+			}
+			recorder := httptest.NewRecorder()
+			webhookHandler(recorder, request)
+
+			if recorder.Code != test.status {
+				t.Fatalf(`status %d is expected, got %d: %s`, test.status, recorder.Code, recorder.Body.String())
+			}
+			if test.status == http.StatusAccepted || test.status == http.StatusOK {
+				response := struct {
+					Triggered []string `json:"triggered"`
+				}{}
+				if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+					t.Fatal(err)
+				}
+				if response.Triggered == nil || len(response.Triggered) > 0 {
+					t.Errorf(`no triggered tasks are expected, got %v`, response.Triggered)
+				}
+			}
+		})
+	}
+}